@@ -0,0 +1,399 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// namespaceNotFound server error code of commands on missing collections
+const namespaceNotFound = 26
+
+// Validation levels and actions of collection validators
+const (
+	ValidationStrict   = "strict"
+	ValidationModerate = "moderate"
+	ValidationOff      = "off"
+	ValidationError    = "error"
+	ValidationWarn     = "warn"
+)
+
+// Granularities of time series collections
+const (
+	GranularitySeconds = "seconds"
+	GranularityMinutes = "minutes"
+	GranularityHours   = "hours"
+)
+
+// ErrInvalidCollection is returned when a collection name or the options of
+// a new collection are not valid
+var ErrInvalidCollection = errors.New("Wrong collection")
+
+// ErrSharedCollection is returned when a tenant view tries to manage
+// collections shared with other tenants
+var ErrSharedCollection = errors.New("Collections are shared by tenants, manage them with the root handler")
+
+// CollectionOptions options of a new collection, the zero value creates a
+// plain collection
+type CollectionOptions struct {
+	// Capped keep at most SizeBytes bytes and MaxDocuments documents,
+	// dropping the oldest ones. SizeBytes is required
+	Capped       bool
+	SizeBytes    int64
+	MaxDocuments int64
+	// Validator query documents must match to be written
+	Validator map[string]interface{}
+	// ValidationLevel ValidationStrict, ValidationModerate or ValidationOff
+	ValidationLevel string
+	// ValidationAction ValidationError or ValidationWarn
+	ValidationAction string
+	// Collation default collation of the collection
+	Collation *Collation
+	// TimeSeries create a time series collection
+	TimeSeries *TimeSeries
+}
+
+// Collation language rules used to compare strings
+type Collation struct {
+	Locale string
+	// Strength 1 ignores case and diacritics, 2 ignores case, 3 by default
+	Strength        int
+	CaseLevel       bool
+	NumericOrdering bool
+}
+
+// TimeSeries options of time series collections
+type TimeSeries struct {
+	// TimeField field holding the date of measurements, required
+	TimeField string
+	// MetaField field holding what identifies the series
+	MetaField string
+	// Granularity GranularitySeconds, GranularityMinutes or GranularityHours
+	Granularity string
+	// ExpireAfter remove measurements older than ExpireAfter
+	ExpireAfter time.Duration
+}
+
+// CollectionStats storage usage of a collection
+type CollectionStats struct {
+	Count int64 `json:"count"`
+	// Size uncompressed size of documents in bytes
+	Size int64 `json:"size"`
+	// StorageSize bytes allocated to documents on disk
+	StorageSize    int64            `json:"storageSize"`
+	TotalIndexSize int64            `json:"totalIndexSize"`
+	IndexSizes     map[string]int64 `json:"indexSizes"`
+	Capped         bool             `json:"capped"`
+}
+
+// collStatsOutput storage stats returned by $collStats for a shard
+type collStatsOutput struct {
+	StorageStats struct {
+		Count          int64            `bson:"count"`
+		Size           int64            `bson:"size"`
+		StorageSize    int64            `bson:"storageSize"`
+		TotalIndexSize int64            `bson:"totalIndexSize"`
+		IndexSizes     map[string]int64 `bson:"indexSizes"`
+		Capped         bool             `bson:"capped"`
+	} `bson:"storageStats"`
+}
+
+// validateCollectionName check name can name a collection managed by the
+// handler
+func validateCollectionName(name string) error {
+	if name == "" || strings.ContainsAny(name, "$\x00") || strings.HasPrefix(name, "system.") {
+		return fmt.Errorf("%w: %q is not a valid name", ErrInvalidCollection, name)
+	}
+	return nil
+}
+
+// manageable check collections of the view can be managed
+func (m *mongoHandler) manageable(dataNames ...string) error {
+	if m.tenantField() != "" {
+		return ErrSharedCollection
+	}
+	for _, dataName := range dataNames {
+		if err := validateCollectionName(dataName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate check options are consistent
+func (o CollectionOptions) validate() error {
+	if o.Capped && o.SizeBytes <= 0 {
+		return fmt.Errorf("%w: capped collections need a size", ErrInvalidCollection)
+	}
+	if !o.Capped && (o.SizeBytes != 0 || o.MaxDocuments != 0) {
+		return fmt.Errorf("%w: size and max documents are only allowed for capped collections", ErrInvalidCollection)
+	}
+	if o.TimeSeries != nil {
+		if o.Capped {
+			return fmt.Errorf("%w: time series collections cannot be capped", ErrInvalidCollection)
+		}
+		if o.TimeSeries.TimeField == "" {
+			return fmt.Errorf("%w: time series collections need a time field", ErrInvalidCollection)
+		}
+	}
+	return nil
+}
+
+// createOptions get driver options of the collection
+func (o CollectionOptions) createOptions() *options.CreateCollectionOptions {
+	createOptions := options.CreateCollection()
+	if o.Capped {
+		createOptions.SetCapped(true).SetSizeInBytes(o.SizeBytes)
+		if o.MaxDocuments > 0 {
+			createOptions.SetMaxDocuments(o.MaxDocuments)
+		}
+	}
+	if o.Validator != nil {
+		createOptions.SetValidator(o.Validator)
+	}
+	if o.ValidationLevel != "" {
+		createOptions.SetValidationLevel(o.ValidationLevel)
+	}
+	if o.ValidationAction != "" {
+		createOptions.SetValidationAction(o.ValidationAction)
+	}
+	if o.Collation != nil {
+		createOptions.SetCollation(&options.Collation{
+			Locale:          o.Collation.Locale,
+			Strength:        o.Collation.Strength,
+			CaseLevel:       o.Collation.CaseLevel,
+			NumericOrdering: o.Collation.NumericOrdering,
+		})
+	}
+	if series := o.TimeSeries; series != nil {
+		timeSeries := options.TimeSeries().SetTimeField(series.TimeField)
+		if series.MetaField != "" {
+			timeSeries.SetMetaField(series.MetaField)
+		}
+		if series.Granularity != "" {
+			timeSeries.SetGranularity(series.Granularity)
+		}
+		createOptions.SetTimeSeriesOptions(timeSeries)
+		if series.ExpireAfter > 0 {
+			createOptions.SetExpireAfterSeconds(int64(series.ExpireAfter / time.Second))
+		}
+	}
+	return createOptions
+}
+
+// ListCollections get names of the collections of the database, sorted
+func (m *mongoHandler) ListCollections() ([]string, error) {
+	call := &Call{Operation: OperationListCollections}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.listCollections()
+	})
+	names, _ := result.([]string)
+	return names, err
+}
+
+func (m *mongoHandler) listCollections() ([]string, error) {
+	if err := m.manageable(); err != nil {
+		return nil, err
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for listing collections of %s. %s\n", m.database, err)
+		return nil, err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	filter := bson.M{"name": bson.M{"$not": bson.M{"$regex": "^system\\."}}}
+	names, err := m.root().connection.Database(m.database).ListCollectionNames(ctx, filter)
+	if err != nil {
+		log.Printf("[App.db]: Error during list collections of %s. %s\n", m.database, err)
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CreateCollection create a collection with options, an error is returned
+// when it already exists
+func (m *mongoHandler) CreateCollection(dataName string, collectionOptions CollectionOptions) error {
+	call := &Call{Operation: OperationCreateCollection, DataName: dataName}
+	_, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, m.createCollection(call.DataName, collectionOptions)
+	})
+	return err
+}
+
+func (m *mongoHandler) createCollection(dataName string, collectionOptions CollectionOptions) error {
+	if err := m.manageable(dataName); err != nil {
+		return err
+	}
+	if err := collectionOptions.validate(); err != nil {
+		return err
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for creating collection %s. %s\n", dataName, err)
+		return err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	err = m.root().connection.Database(m.database).CreateCollection(ctx, dataName, collectionOptions.createOptions())
+	if err != nil {
+		log.Printf("[App.db]: Error during create collection %s. %s\n", dataName, err)
+	}
+	return err
+}
+
+// DropCollection remove a collection with its documents and indexes,
+// dropping a missing collection is not an error. The history collection of
+// collections with history is dropped too
+func (m *mongoHandler) DropCollection(dataName string) error {
+	call := &Call{Operation: OperationDropCollection, DataName: dataName}
+	_, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, m.dropCollection(call.DataName)
+	})
+	return err
+}
+
+func (m *mongoHandler) dropCollection(dataName string) error {
+	if err := m.manageable(dataName); err != nil {
+		return err
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for dropping collection %s. %s\n", dataName, err)
+		return err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	names := []string{dataName}
+	if m.configOf(dataName).history {
+		names = append(names, dataName+historySuffix)
+	}
+	for _, name := range names {
+		if err = m.collection(name).Drop(ctx); err != nil {
+			log.Printf("[App.db]: Error during drop collection %s. %s\n", name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// RenameCollection rename a collection, ErrNotFound is returned when it does
+// not exist and an error when newName is already used. The history
+// collection of collections with history is renamed too, so history must be
+// enabled for newName to keep recording it
+func (m *mongoHandler) RenameCollection(dataName, newName string) error {
+	call := &Call{Operation: OperationRenameCollection, DataName: dataName, Target: m.database + "." + newName}
+	_, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, m.renameCollection(call.DataName, newName)
+	})
+	return err
+}
+
+func (m *mongoHandler) renameCollection(dataName, newName string) error {
+	if err := m.manageable(dataName, newName); err != nil {
+		return err
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for renaming collection %s. %s\n", dataName, err)
+		return err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	if err = m.renameNamespace(ctx, dataName, newName); err != nil {
+		return err
+	}
+	if !m.configOf(dataName).history {
+		return nil
+	}
+	// Collections without revisions yet have no history collection
+	err = m.renameNamespace(ctx, dataName+historySuffix, newName+historySuffix)
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// renameNamespace rename a collection of the database, ErrNotFound is
+// returned when it does not exist
+func (m *mongoHandler) renameNamespace(ctx context.Context, dataName, newName string) error {
+	rename := bson.D{
+		{Key: "renameCollection", Value: m.database + "." + dataName},
+		{Key: "to", Value: m.database + "." + newName},
+	}
+	err := m.root().connection.Database("admin").RunCommand(ctx, rename).Err()
+	if commandErr, ok := err.(mongo.CommandError); ok && commandErr.HasErrorCode(namespaceNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		log.Printf("[App.db]: Error during rename collection %s to %s. %s\n", dataName, newName, err)
+	}
+	return err
+}
+
+// CollectionStats get document count and storage sizes of a collection,
+// summed over shards
+func (m *mongoHandler) CollectionStats(dataName string) (CollectionStats, error) {
+	call := &Call{Operation: OperationCollectionStats, DataName: dataName}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.collectionStats(call.DataName)
+	})
+	stats, _ := result.(CollectionStats)
+	return stats, err
+}
+
+func (m *mongoHandler) collectionStats(dataName string) (CollectionStats, error) {
+	if err := m.manageable(dataName); err != nil {
+		return CollectionStats{}, err
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for getting stats of %s. %s\n", dataName, err)
+		return CollectionStats{}, err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	pipeline := []bson.M{{"$collStats": bson.M{"storageStats": bson.M{}}}}
+	cursor, err := m.collection(dataName).Aggregate(ctx, pipeline, options.Aggregate().SetMaxTime(m.readMaxTime()))
+	if commandErr, ok := err.(mongo.CommandError); ok && commandErr.HasErrorCode(namespaceNotFound) {
+		return CollectionStats{}, ErrNotFound
+	}
+	if err != nil {
+		log.Printf("[App.db]: Error during get stats of %s. %s\n", dataName, err)
+		return CollectionStats{}, err
+	}
+	var outputs []collStatsOutput
+	if err = cursor.All(ctx, &outputs); err != nil {
+		return CollectionStats{}, err
+	}
+	if len(outputs) == 0 {
+		return CollectionStats{}, ErrNotFound
+	}
+	stats := CollectionStats{IndexSizes: map[string]int64{}}
+	for _, output := range outputs {
+		storage := output.StorageStats
+		stats.Count += storage.Count
+		stats.Size += storage.Size
+		stats.StorageSize += storage.StorageSize
+		stats.TotalIndexSize += storage.TotalIndexSize
+		stats.Capped = storage.Capped
+		for index, size := range storage.IndexSizes {
+			stats.IndexSizes[index] += size
+		}
+	}
+	return stats, nil
+}
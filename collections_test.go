@@ -0,0 +1,122 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCollectionOptionsValidate(t *testing.T) {
+	tests := []struct {
+		options CollectionOptions
+		valid   bool
+	}{
+		{CollectionOptions{}, true},
+		{CollectionOptions{Capped: true, SizeBytes: 1 << 20, MaxDocuments: 100}, true},
+		{CollectionOptions{TimeSeries: &TimeSeries{TimeField: "at", Granularity: GranularityMinutes}}, true},
+		{CollectionOptions{Capped: true}, false},
+		{CollectionOptions{MaxDocuments: 100}, false},
+		{CollectionOptions{TimeSeries: &TimeSeries{MetaField: "sensor"}}, false},
+		{CollectionOptions{Capped: true, SizeBytes: 1 << 20, TimeSeries: &TimeSeries{TimeField: "at"}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.options.validate(); (err == nil) != tt.valid || err != nil && !errors.Is(err, ErrInvalidCollection) {
+			t.Fatalf("Options %+v must be valid %v but got %v", tt.options, tt.valid, err)
+		}
+	}
+	createOptions := CollectionOptions{
+		Validator:        map[string]interface{}{"actorID": map[string]interface{}{"$exists": true}},
+		ValidationLevel:  ValidationModerate,
+		ValidationAction: ValidationWarn,
+		Collation:        &Collation{Locale: "fr", Strength: 2},
+		TimeSeries:       &TimeSeries{TimeField: "at", MetaField: "sensor", ExpireAfter: 24 * time.Hour},
+	}.createOptions()
+	if *createOptions.ValidationLevel != ValidationModerate || *createOptions.ValidationAction != ValidationWarn || createOptions.Validator == nil {
+		t.Fatalf("Validator options must be set, got %+v", createOptions)
+	}
+	if createOptions.Collation.Locale != "fr" || createOptions.Collation.Strength != 2 {
+		t.Fatalf("Collation must be set, got %+v", createOptions.Collation)
+	}
+	if createOptions.TimeSeriesOptions.TimeField != "at" || *createOptions.TimeSeriesOptions.MetaField != "sensor" || *createOptions.ExpireAfterSeconds != 86400 {
+		t.Fatalf("Time series options must be set, got %+v", createOptions.TimeSeriesOptions)
+	}
+	if createOptions.Capped != nil {
+		t.Fatalf("Collections must not be capped unless asked")
+	}
+}
+
+func TestCollectionNames(t *testing.T) {
+	for _, name := range []string{"", "system.users", "bad$name"} {
+		if err := validateCollectionName(name); !errors.Is(err, ErrInvalidCollection) {
+			t.Fatalf("Name %q must return ErrInvalidCollection but got %v", name, err)
+		}
+	}
+	dbhandler := &mongoHandler{}
+	if err := dbhandler.DropCollection("system.users"); !errors.Is(err, ErrInvalidCollection) || errorClass(err) != "invalid_argument" {
+		t.Fatalf("Dropping system collections must return ErrInvalidCollection but got %v", err)
+	}
+	if err := dbhandler.ForTenant("acme").DropCollection(collectionName); err != ErrSharedCollection {
+		t.Fatalf("Tenant views must not drop shared collections, got %v", err)
+	}
+}
+
+func TestCollectionAdmin(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	if err := dbhandler.CreateCollection("events", CollectionOptions{Capped: true, SizeBytes: 1 << 20, MaxDocuments: 10}); err != nil {
+		t.Fatalf("Create must not return error but got %s", err.Error())
+	}
+	if err := dbhandler.CreateCollection("events", CollectionOptions{}); err == nil {
+		t.Fatalf("Creating an existing collection must return error")
+	}
+	names, err := dbhandler.ListCollections()
+	if err != nil || len(names) != 2 || names[0] != "events" || names[1] != collectionName {
+		t.Fatalf("Expected collections [events %s] but got %v and %v", collectionName, names, err)
+	}
+	stats, err := dbhandler.CollectionStats(collectionName)
+	if err != nil {
+		t.Fatalf("Stats must not return error but got %s", err.Error())
+	}
+	if stats.Count != 3 || stats.Size == 0 || stats.IndexSizes["_id_"] == 0 || stats.Capped {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	if stats, err = dbhandler.CollectionStats("events"); err != nil || !stats.Capped {
+		t.Fatalf("Capped collections must be reported, got %+v and %v", stats, err)
+	}
+	if err = dbhandler.RenameCollection("events", "archived_events"); err != nil {
+		t.Fatalf("Rename must not return error but got %s", err.Error())
+	}
+	if err = dbhandler.RenameCollection("events", "other_events"); err != ErrNotFound {
+		t.Fatalf("Renaming a missing collection must return ErrNotFound but got %v", err)
+	}
+	if err = dbhandler.DropCollection("archived_events"); err != nil {
+		t.Fatalf("Drop must not return error but got %s", err.Error())
+	}
+	if names, _ = dbhandler.ListCollections(); len(names) != 1 {
+		t.Fatalf("Dropped collections must not be listed, got %v", names)
+	}
+	if err = dbhandler.DropCollection("archived_events"); err != nil {
+		t.Fatalf("Dropping a missing collection must not return error but got %s", err.Error())
+	}
+}
+
+func TestCollectionAdminHistory(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	WithHistory(collectionName)(dbhandler)
+	if err := dbhandler.UpdateByID(collectionName, fixtureFirstMessageID, map[string]interface{}{"content": "changed"}); err != nil {
+		t.Fatalf("Update must not return error but got %s", err.Error())
+	}
+	if err := dbhandler.RenameCollection(collectionName, "archived"); err != nil {
+		t.Fatalf("Rename must not return error but got %s", err.Error())
+	}
+	names, err := dbhandler.ListCollections()
+	if err != nil || len(names) != 2 || names[0] != "archived" || names[1] != "archived"+historySuffix {
+		t.Fatalf("History collections must be renamed, got %v and %v", names, err)
+	}
+	WithHistory("archived")(dbhandler)
+	if err = dbhandler.DropCollection("archived"); err != nil {
+		t.Fatalf("Drop must not return error but got %s", err.Error())
+	}
+	if names, _ = dbhandler.ListCollections(); len(names) != 0 {
+		t.Fatalf("History collections must be dropped, got %v", names)
+	}
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/tag"
+)
+
+// ReadMode replica set members a read may be served by
+type ReadMode string
+
+// Read modes
+const (
+	ReadPrimary            ReadMode = "primary"
+	ReadPrimaryPreferred   ReadMode = "primaryPreferred"
+	ReadSecondary          ReadMode = "secondary"
+	ReadSecondaryPreferred ReadMode = "secondaryPreferred"
+	ReadNearest            ReadMode = "nearest"
+)
+
+// minMaxStaleness smallest max staleness accepted by servers
+const minMaxStaleness = 90 * time.Second
+
+var readModes = map[ReadMode]readpref.Mode{
+	ReadPrimary:            readpref.PrimaryMode,
+	ReadPrimaryPreferred:   readpref.PrimaryPreferredMode,
+	ReadSecondary:          readpref.SecondaryMode,
+	ReadSecondaryPreferred: readpref.SecondaryPreferredMode,
+	ReadNearest:            readpref.NearestMode,
+}
+
+// ErrInvalidReadPreference is returned when a read preference is not valid
+var ErrInvalidReadPreference = errors.New("Wrong read preference")
+
+// ReadPreference where reads are routed in a replica set
+type ReadPreference struct {
+	Mode ReadMode
+	// Tags sets in order of preference, a member must match all tags of a set
+	Tags []map[string]string
+	// MaxStaleness how far a secondary may lag behind the primary, at least
+	// 90 seconds
+	MaxStaleness time.Duration
+}
+
+// WriteConcern acknowledgement required from the server for writes
+type WriteConcern struct {
+	// W number of members which must acknowledge the write
+	W int
+	// WMode "majority" or a custom write concern name, overrides W
+	WMode string
+	// J wait for the write to reach the journal
+	J bool
+	// WTimeout how long to wait for W, exceeding it returns a TimeoutError
+	WTimeout time.Duration
+}
+
+// WithReadPreference set the default read preference of the handler
+func WithReadPreference(preference ReadPreference) Option {
+	return func(m *mongoHandler) {
+		m.readPreference = preference
+	}
+}
+
+// WithWriteConcern set the default write concern of the handler
+func WithWriteConcern(concern WriteConcern) Option {
+	return func(m *mongoHandler) {
+		m.writeConcern = &concern
+	}
+}
+
+// UsingReadPreference get a view of the handler reading with preference,
+// e.g. to send analytics queries to secondaries
+func (m *mongoHandler) UsingReadPreference(preference ReadPreference) DatabaseHandler {
+	view := m.view()
+	view.readPreference = preference
+	return view
+}
+
+// UsingWriteConcern get a view of the handler writing with concern,
+// e.g. to require majority acknowledgement of critical writes
+func (m *mongoHandler) UsingWriteConcern(concern WriteConcern) DatabaseHandler {
+	view := m.view()
+	view.writeConcern = &concern
+	return view
+}
+
+func (preference ReadPreference) validate() error {
+	if preference.Mode == "" {
+		return nil
+	}
+	if _, ok := readModes[preference.Mode]; !ok {
+		return ErrInvalidReadPreference
+	}
+	if preference.Mode == ReadPrimary && (len(preference.Tags) > 0 || preference.MaxStaleness > 0) {
+		return ErrInvalidReadPreference
+	}
+	if preference.MaxStaleness > 0 && preference.MaxStaleness < minMaxStaleness {
+		return ErrInvalidReadPreference
+	}
+	return nil
+}
+
+// readPref convert the preference to the driver read preference
+func (preference ReadPreference) readPref() (*readpref.ReadPref, error) {
+	var opts []readpref.Option
+	if len(preference.Tags) > 0 {
+		opts = append(opts, readpref.WithTagSets(preference.tagSets()...))
+	}
+	if preference.MaxStaleness > 0 {
+		opts = append(opts, readpref.WithMaxStaleness(preference.MaxStaleness))
+	}
+	return readpref.New(readModes[preference.Mode], opts...)
+}
+
+// tagSets convert tag sets to driver tag sets with tags in a stable order
+func (preference ReadPreference) tagSets() []tag.Set {
+	sets := make([]tag.Set, len(preference.Tags))
+	for index, tags := range preference.Tags {
+		keys := make([]string, 0, len(tags))
+		for key := range tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		set := make(tag.Set, len(keys))
+		for position, key := range keys {
+			set[position] = tag.Tag{Name: key, Value: tags[key]}
+		}
+		sets[index] = set
+	}
+	return sets
+}
+
+// writeConcern convert the concern to the driver write concern
+func (concern WriteConcern) writeConcern() *writeconcern.WriteConcern {
+	converted := &writeconcern.WriteConcern{WTimeout: concern.WTimeout}
+	if concern.WMode != "" {
+		converted.W = concern.WMode
+	} else if concern.W > 0 {
+		converted.W = concern.W
+	}
+	if concern.J {
+		journal := true
+		converted.Journal = &journal
+	}
+	return converted
+}
+
+// collectionOptions get read preference and write concern of the handler
+// as collection options
+func (m *mongoHandler) collectionOptions() *options.CollectionOptions {
+	collectionOptions := options.Collection()
+	if m.readPreference.Mode != "" {
+		// Preferences are validated before any call reaches the driver
+		if readPref, err := m.readPreference.readPref(); err == nil {
+			collectionOptions.SetReadPreference(readPref)
+		}
+	}
+	if m.writeConcern != nil {
+		collectionOptions.SetWriteConcern(m.writeConcern.writeConcern())
+	}
+	return collectionOptions
+}
+
+// collection get a collection of the handler database using its read
+// preference and write concern
+func (m *mongoHandler) collection(dataName string) *mongo.Collection {
+	return m.root().connection.Database(m.database).Collection(dataName, m.collectionOptions())
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
+)
+
+func TestReadPreferenceValidate(t *testing.T) {
+	cases := []struct {
+		preference ReadPreference
+		valid      bool
+	}{
+		{ReadPreference{}, true},
+		{ReadPreference{Mode: ReadPrimary}, true},
+		{ReadPreference{Mode: ReadSecondary, Tags: []map[string]string{{"dc": "east"}}, MaxStaleness: 2 * time.Minute}, true},
+		{ReadPreference{Mode: "secondaries"}, false},
+		{ReadPreference{Mode: ReadPrimary, Tags: []map[string]string{{"dc": "east"}}}, false},
+		{ReadPreference{Mode: ReadNearest, MaxStaleness: 10 * time.Second}, false},
+	}
+	for _, c := range cases {
+		if err := c.preference.validate(); (err == nil) != c.valid {
+			t.Fatalf("Validation of %+v must be %v but got %v", c.preference, c.valid, err)
+		}
+	}
+}
+
+func TestReadPreferenceReadPref(t *testing.T) {
+	preference := ReadPreference{Mode: ReadNearest, Tags: []map[string]string{{"rack": "1", "dc": "east"}, {}}, MaxStaleness: 2 * time.Minute}
+	readPref, err := preference.readPref()
+	if err != nil {
+		t.Fatalf("Read preference must be converted but got %s", err.Error())
+	}
+	expected := []tag.Set{{{Name: "dc", Value: "east"}, {Name: "rack", Value: "1"}}, {}}
+	if sets := readPref.TagSets(); !reflect.DeepEqual(sets, expected) {
+		t.Fatalf("Expected %v but got %v", expected, sets)
+	}
+	if maxStaleness, _ := readPref.MaxStaleness(); readPref.Mode() != readpref.NearestMode || maxStaleness != 2*time.Minute {
+		t.Fatalf("Expected nearest mode with max staleness but got %v", readPref)
+	}
+}
+
+func TestUsingWriteConcern(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	WithWriteConcern(WriteConcern{W: 1})(dbhandler)
+	view := dbhandler.UsingWriteConcern(WriteConcern{WMode: "majority", J: true, WTimeout: 5 * time.Second}).(*mongoHandler)
+	concern := view.writeConcern.writeConcern()
+	if concern.W != "majority" || concern.Journal == nil || !*concern.Journal || concern.WTimeout != 5*time.Second {
+		t.Fatalf("Unexpected write concern %+v", concern)
+	}
+	if dbhandler.writeConcern.W != 1 || dbhandler.writeConcern.WMode != "" {
+		t.Fatalf("Overrides must not change the handler")
+	}
+	wtimeout := mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{Code: writeConcernTimeoutCode}}
+	if _, ok := timeoutError(wtimeout).(TimeoutError); !ok {
+		t.Fatalf("Write concern timeouts must be converted to TimeoutError")
+	}
+}
+
+func TestInterceptInvalidReadPreference(t *testing.T) {
+	view := (&mongoHandler{}).UsingReadPreference(ReadPreference{Mode: "anywhere"}).(*mongoHandler)
+	_, err := view.intercept(&Call{Operation: OperationFindBy, DataName: collectionName}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, nil
+	})
+	if err != ErrInvalidReadPreference {
+		t.Fatalf("Calls with a wrong read preference must fail but got %v", err)
+	}
+}
+
+func TestCollectionOptions(t *testing.T) {
+	view := (&mongoHandler{}).UsingReadPreference(ReadPreference{Mode: ReadPrimaryPreferred}).UsingWriteConcern(WriteConcern{W: 1, J: true}).(*mongoHandler)
+	collectionOptions := view.collectionOptions()
+	if readPref := collectionOptions.ReadPreference; readPref == nil || readPref.Mode() != readpref.PrimaryPreferredMode {
+		t.Fatalf("Collections must read with the preference of the view, got %v", readPref)
+	}
+	if concern := collectionOptions.WriteConcern; concern == nil || concern.W != 1 || concern.Journal == nil || !*concern.Journal {
+		t.Fatalf("Collections must use the write concern of the view, got %+v", concern)
+	}
+	if collectionOptions := (&mongoHandler{}).collectionOptions(); collectionOptions.ReadPreference != nil || collectionOptions.WriteConcern != nil {
+		t.Fatalf("Handlers without consistency settings must use the client defaults")
+	}
+}
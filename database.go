@@ -0,0 +1,119 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultCopyBatchSize number of documents written at once by CopyItems
+const DefaultCopyBatchSize = 1000
+
+// maxDatabaseNameBytes longest database name accepted by servers
+const maxDatabaseNameBytes = 63
+
+// forbiddenDatabaseChars characters not allowed in database names
+const forbiddenDatabaseChars = "/\\. \"$*<>:|?\x00"
+
+// ErrInvalidDatabase is returned by calls of a view using a database name
+// the server does not accept
+var ErrInvalidDatabase = errors.New("Wrong database name")
+
+// UsingDatabase get a view of the handler working on another database
+// through the same connection, e.g. to write reports to an analytics
+// database while reading notifications
+func (m *mongoHandler) UsingDatabase(database string) DatabaseHandler {
+	view := m.view()
+	view.database = view.tenantDatabase(database)
+	return view
+}
+
+// validateDatabase check the database of views, the database of the root
+// handler is trusted
+func (m *mongoHandler) validateDatabase() error {
+	if m.parent == nil || m.database == m.parent.database {
+		return nil
+	}
+	if m.database == "" || len(m.database) > maxDatabaseNameBytes || strings.ContainsAny(m.database, forbiddenDatabaseChars) {
+		return fmt.Errorf("%w: %q", ErrInvalidDatabase, m.database)
+	}
+	return nil
+}
+
+// CopyItems copy items of a collection matching filters into a collection
+// of another database and return how many were copied. Items keep their id
+// and replace items with the same id, so a copy can be run again. Tenant
+// views only replace items of their tenant
+func (m *mongoHandler) CopyItems(dataName, toDatabase, toDataName string, filters map[string]interface{}) (int, error) {
+	call := &Call{Operation: OperationCopyItems, DataName: dataName, Filter: filters, Target: toDatabase + "." + toDataName}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.copyItems(call.DataName, toDatabase, toDataName, call.Filter)
+	})
+	copied, _ := result.(int)
+	return copied, err
+}
+
+func (m *mongoHandler) copyItems(dataName, toDatabase, toDataName string, filters map[string]interface{}) (int, error) {
+	target := m.UsingDatabase(toDatabase).(*mongoHandler)
+	if err := target.validateDatabase(); err != nil {
+		return 0, err
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for copying %s. %s\n", dataName, err)
+		return 0, err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	source := m.collection(dataName)
+	destination := target.collection(toDataName)
+	cursor, err := source.Find(ctx, m.scopeFilter(dataName, filters), options.Find().SetMaxTime(m.readMaxTime()).SetBatchSize(DefaultCopyBatchSize))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+	copied := 0
+	batch := make([]mongo.WriteModel, 0, DefaultCopyBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := destination.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		copied += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return copied, err
+		}
+		// Items of other tenants with the same id are not matched, their
+		// insert fails with a duplicate key error instead of replacing them
+		selector := target.tenantFilter(bson.M{"_id": doc["_id"]})
+		batch = append(batch, mongo.NewReplaceOneModel().SetFilter(selector).SetReplacement(doc).SetUpsert(true))
+		if len(batch) == DefaultCopyBatchSize {
+			if err := flush(); err != nil {
+				log.Printf("[App.db]: Error during copying %s to %s.%s. %s\n", dataName, toDatabase, toDataName, err)
+				return copied, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return copied, err
+	}
+	if err := flush(); err != nil {
+		log.Printf("[App.db]: Error during copying %s to %s.%s. %s\n", dataName, toDatabase, toDataName, err)
+		return copied, err
+	}
+	return copied, nil
+}
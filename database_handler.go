@@ -1,5 +1,10 @@
 package db
 
+import (
+	"context"
+	"time"
+)
+
 // PagedResults paged results from db
 type PagedResults struct {
 	Total           int                      `json:"total"`
@@ -23,10 +28,36 @@ type DatabaseHandler interface {
 	AddNewItem(dataName string, item map[string]interface{}) (map[string]interface{}, error)
 	RemoveItemByID(dataName string, id interface{}) error
 	RemoveItemBy(dataName string, selector map[string]interface{}) error
+	RemoveAllBy(dataName string, selector map[string]interface{}) (int, error)
 	FindItemByID(dataName string, id interface{}) (map[string]interface{}, error)
 	FindBy(dataName string, selector map[string]interface{}) (map[string]interface{}, error)
 	UpdateBy(dataName string, selector, update map[string]interface{}) (int, error)
 	UpdateByID(dataName string, id interface{}, update map[string]interface{}) error
+	UpsertBy(dataName string, selector, update map[string]interface{}) (string, error)
+	UpdateByIDIfVersion(dataName string, id interface{}, version int, update map[string]interface{}) error
+	ModifyByID(dataName string, id interface{}, modify func(item map[string]interface{}) error) error
+	Revisions(dataName string, id interface{}) ([]Revision, error)
+	RestoreRevision(dataName string, revisionID interface{}) error
+	Explain(dataName string, filter map[string]interface{}, sort ...string) (ExplainResult, error)
+	AsActor(actor string) DatabaseHandler
+	WithContext(ctx context.Context) DatabaseHandler
+	WithTimeouts(maxTime, socketTimeout time.Duration) DatabaseHandler
+	UsingReadPreference(preference ReadPreference) DatabaseHandler
+	UsingWriteConcern(concern WriteConcern) DatabaseHandler
+	Sanitizing(sanitizer Sanitizer) DatabaseHandler
+	ForTenant(id string) DatabaseHandler
+	UsingDatabase(database string) DatabaseHandler
+	CopyItems(dataName, toDatabase, toDataName string, filters map[string]interface{}) (int, error)
+	ListCollections() ([]string, error)
+	CreateCollection(dataName string, options CollectionOptions) error
+	DropCollection(dataName string) error
+	RenameCollection(dataName, newName string) error
+	CollectionStats(dataName string) (CollectionStats, error)
+	PushSchema(dataName, level, action string) error
+	Distinct(dataName, field string, filter map[string]interface{}) ([]interface{}, error)
+	CountBy(dataName, field string, filter map[string]interface{}) ([]GroupCount, error)
+	Restore(dataName string, id interface{}) error
+	Purge(dataName string, olderThan time.Duration) (int, error)
 	// UpdateByDeviceAndTokenFirebase(dataName string, userID int, device string, token string) (map[string]interface{}, error)
 	// DeleteUserTopicDeviceToken(dataName string, info map[string]interface{}) error
 	IsConnecting() bool
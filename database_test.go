@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestUsingDatabase(t *testing.T) {
+	dbhandler := &mongoHandler{database: "notifications"}
+	view := dbhandler.UsingDatabase("analytics").(*mongoHandler)
+	if view.database != "analytics" || view.root() != dbhandler || dbhandler.database != "notifications" {
+		t.Fatalf("Database views must share the root handler, got %s", view.database)
+	}
+	var database string
+	view.intercept(&Call{Operation: OperationFindBy}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		database = call.Database
+		return nil, nil
+	})
+	if database != "analytics" {
+		t.Fatalf("Calls of database views must have their database, got %s", database)
+	}
+	WithDatabasePerTenant()(dbhandler)
+	tenant := dbhandler.ForTenant("acme").UsingDatabase("analytics").(*mongoHandler)
+	if tenant.database != "analytics_acme" {
+		t.Fatalf("Tenant views must stay in the tenant database, got %s", tenant.database)
+	}
+	if tenant = dbhandler.UsingDatabase("analytics").ForTenant("acme").(*mongoHandler); tenant.database != "analytics_acme" {
+		t.Fatalf("Tenant databases must be named after the view database, got %s", tenant.database)
+	}
+	for _, database := range []string{"", "my.db", "a b", strings.Repeat("a", 64)} {
+		_, err := dbhandler.UsingDatabase(database).(*mongoHandler).intercept(&Call{Operation: OperationFindBy}, func(m *mongoHandler, call *Call) (interface{}, error) {
+			return nil, nil
+		})
+		if !errors.Is(err, ErrInvalidDatabase) {
+			t.Fatalf("Database %q must return ErrInvalidDatabase but got %v", database, err)
+		}
+	}
+}
+
+func TestCopyItems(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	archive := dbhandler.database + "_archive"
+	t.Cleanup(func() {
+		if dbhandler.connection != nil {
+			dbhandler.connection.Database(archive).Drop(dbhandler.context())
+		}
+	})
+	copied, err := dbhandler.CopyItems(collectionName, archive, "archived", map[string]interface{}{"category": "comment"})
+	if err != nil {
+		t.Fatalf("Copy must not return error but got %s", err.Error())
+	}
+	if copied != 2 {
+		t.Fatalf("Copy must copy 2 items but copied %d", copied)
+	}
+	target := dbhandler.UsingDatabase(archive)
+	item, err := target.FindItemByID("archived", fixtureFirstMessageID)
+	if err != nil || item["content"] != "First fixture message" {
+		t.Fatalf("Copied items must keep their id and fields, got %v and %v", item, err)
+	}
+	if copied, err = dbhandler.CopyItems(collectionName, archive, "archived", map[string]interface{}{"category": "comment"}); err != nil || copied != 2 {
+		t.Fatalf("Copy must be run again without duplicate errors, got %d and %v", copied, err)
+	}
+	if total, _ := target.GetTotal("archived", map[string]interface{}{}); total != 2 {
+		t.Fatalf("Copying again must replace items, got total %d", total)
+	}
+	if !dbhandler.IsConnecting() || !target.IsConnecting() {
+		t.Fatalf("Database views must share the connection of the root handler")
+	}
+}
+
+func TestCopyItemsTenant(t *testing.T) {
+	dbhandler := newTestHandler(t)
+	archive := dbhandler.database + "_archive"
+	t.Cleanup(func() {
+		if dbhandler.connection != nil {
+			dbhandler.connection.Database(archive).Drop(dbhandler.context())
+		}
+	})
+	acme := dbhandler.ForTenant("acme")
+	item, err := acme.AddNewItem(collectionName, map[string]interface{}{"content": "acme"})
+	if err != nil {
+		t.Fatalf("Insert must not return error but got %s", err.Error())
+	}
+	id, _ := createObjectID(item["_id"])
+	if _, err = dbhandler.connection.Database(archive).Collection("archived").InsertOne(dbhandler.context(), bson.M{"_id": id, DefaultTenantField: "globex", "content": "globex"}); err != nil {
+		t.Fatalf("Fail to insert item of another tenant: %s", err.Error())
+	}
+	if _, err = acme.CopyItems(collectionName, archive, "archived", map[string]interface{}{}); err == nil {
+		t.Fatalf("Copying over an item of another tenant must return error")
+	}
+	copied, err := dbhandler.ForTenant("globex").UsingDatabase(archive).FindItemByID("archived", id)
+	if err != nil || copied["content"] != "globex" {
+		t.Fatalf("Items of other tenants must not be replaced, got %v and %v", copied, err)
+	}
+}
+
+func TestViewsShareConnection(t *testing.T) {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatalf("Fail to create client: %s", err.Error())
+	}
+	defer client.Disconnect(context.Background())
+	dbhandler := &mongoHandler{database: "notifications", connection: client}
+	view := dbhandler.ForTenant("acme").(*mongoHandler)
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			view.GetConnection()
+			view.collection(collectionName)
+		}()
+	}
+	wg.Wait()
+	view.CloseConnection()
+	if view.connection != nil || !view.IsConnecting() || dbhandler.connection != client {
+		t.Fatalf("Views must use the connection of the root handler without storing it")
+	}
+}
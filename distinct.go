@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GroupCount number of documents sharing the same value of a field
+type GroupCount struct {
+	Value interface{} `json:"value"`
+	Count int         `json:"count"`
+}
+
+// Distinct get distinct values of a field in documents matching filter.
+// ObjectId values are returned as hex strings
+func (m *mongoHandler) Distinct(dataName, field string, filter map[string]interface{}) ([]interface{}, error) {
+	call := &Call{Operation: OperationDistinct, DataName: dataName, Field: field, Filter: filter}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.distinct(call.DataName, call.Field, call.Filter)
+	})
+	values, _ := result.([]interface{})
+	return values, err
+}
+
+func (m *mongoHandler) distinct(dataName, field string, filter map[string]interface{}) ([]interface{}, error) {
+	if err := validateFieldName(field); err != nil {
+		return nil, err
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
+		return nil, err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	values, err := c.Distinct(ctx, field, m.scopeFilter(dataName, filter), options.Distinct().SetMaxTime(m.readMaxTime()))
+	if err != nil {
+		log.Printf("[App.db]: Error during get distinct %s: %s\n", field, err)
+		return nil, err
+	}
+	if err = checkResultSize(dataName, len(values), m.maxResultsOf(dataName)); err != nil {
+		return nil, err
+	}
+	for index, value := range values {
+		values[index] = normalizeValue(value)
+	}
+	return values, nil
+}
+
+// CountBy count documents matching filter grouped by value of a field,
+// ordered by count descending. Documents missing the field are grouped under nil
+func (m *mongoHandler) CountBy(dataName, field string, filter map[string]interface{}) ([]GroupCount, error) {
+	call := &Call{Operation: OperationCountBy, DataName: dataName, Field: field, Filter: filter}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.countBy(call.DataName, call.Field, call.Filter)
+	})
+	groups, _ := result.([]GroupCount)
+	return groups, err
+}
+
+func (m *mongoHandler) countBy(dataName, field string, filter map[string]interface{}) ([]GroupCount, error) {
+	if err := validateFieldName(field); err != nil {
+		return nil, err
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
+		return nil, err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	pipeline := []bson.M{
+		{"$group": bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+	}
+	if filter = m.scopeFilter(dataName, filter); len(filter) > 0 {
+		pipeline = append([]bson.M{{"$match": filter}}, pipeline...)
+	}
+	maxResults := m.maxResultsOf(dataName)
+	if maxResults > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": maxResults + 1})
+	}
+	var groups []struct {
+		Value interface{} `bson:"_id"`
+		Count int         `bson:"count"`
+	}
+	cursor, err := c.Aggregate(ctx, pipeline, options.Aggregate().SetMaxTime(m.readMaxTime()))
+	if err == nil {
+		err = cursor.All(ctx, &groups)
+	}
+	if err != nil {
+		log.Printf("[App.db]: Error during count by %s: %s\n", field, err)
+		return nil, err
+	}
+	if err = checkResultSize(dataName, len(groups), maxResults); err != nil {
+		return nil, err
+	}
+	results := make([]GroupCount, len(groups))
+	for index, group := range groups {
+		results[index] = GroupCount{Value: normalizeValue(group.Value), Count: group.Count}
+	}
+	return results, nil
+}
+
+// countItems count documents matching filters. Unfiltered counts use the
+// collection metadata which is fast but may be slightly off after an unclean
+// shutdown or on sharded clusters with orphaned documents
+func (m *mongoHandler) countItems(ctx context.Context, c *mongo.Collection, filters map[string]interface{}) (int, error) {
+	var total int64
+	var err error
+	if len(filters) == 0 {
+		total, err = c.EstimatedDocumentCount(ctx, options.EstimatedDocumentCount().SetMaxTime(m.readMaxTime()))
+	} else {
+		total, err = c.CountDocuments(ctx, filters, options.Count().SetMaxTime(m.readMaxTime()))
+	}
+	return int(total), err
+}
+
+func validateFieldName(field string) error {
+	if field == "" || strings.HasPrefix(field, "$") {
+		return errors.New("Wrong field name: " + field)
+	}
+	return nil
+}
+
+// normalizeValue convert ObjectId values to hex strings, dates and 32 bits
+// integers to the types items are decoded into
+func normalizeValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case primitive.ObjectID:
+		return typed.Hex()
+	case primitive.DateTime:
+		return typed.Time().Local()
+	case int32:
+		return int(typed)
+	}
+	return value
+}
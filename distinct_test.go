@@ -0,0 +1,74 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDistinct(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	values, err := dbhandler.Distinct(collectionName, "category", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Distinct must not return error but got %s", err.Error())
+	}
+	categories := make([]string, len(values))
+	for index, value := range values {
+		categories[index] = value.(string)
+	}
+	sort.Strings(categories)
+	if expected := []string{"comment", "like"}; !reflect.DeepEqual(categories, expected) {
+		t.Fatalf("Expected %v but got %v", expected, categories)
+	}
+}
+
+func TestDistinctObjectIDAsHex(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	values, err := dbhandler.Distinct(collectionName, "_id", map[string]interface{}{"category": "like"})
+	if err != nil {
+		t.Fatalf("Distinct must not return error but got %s", err.Error())
+	}
+	if expected := []interface{}{"5b8f5bd2a7e3b5a0c4a1f003"}; !reflect.DeepEqual(values, expected) {
+		t.Fatalf("Expected %v but got %v", expected, values)
+	}
+}
+
+func TestCountBy(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	results, err := dbhandler.CountBy(collectionName, "actorID", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("CountBy must not return error but got %s", err.Error())
+	}
+	expected := []GroupCount{{Value: 1, Count: 2}, {Value: 2, Count: 1}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("Expected %v but got %v", expected, results)
+	}
+	results, err = dbhandler.CountBy(collectionName, "actorID", map[string]interface{}{"seen": false})
+	if err != nil {
+		t.Fatalf("CountBy must not return error but got %s", err.Error())
+	}
+	expected = []GroupCount{{Value: 1, Count: 2}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("Expected %v but got %v", expected, results)
+	}
+}
+
+func TestCountByInvalidField(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	if _, err := dbhandler.CountBy(collectionName, "$where", nil); err == nil {
+		t.Fatalf("CountBy must reject operator as field name")
+	}
+	if _, err := dbhandler.Distinct(collectionName, "", nil); err == nil {
+		t.Fatalf("Distinct must reject empty field name")
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	objectID := mustObjectID("5b8f5bd2a7e3b5a0c4a1f001")
+	if got := normalizeValue(objectID); got != "5b8f5bd2a7e3b5a0c4a1f001" {
+		t.Fatalf("Expected hex string but got %v", got)
+	}
+	if got := normalizeValue(12); got != 12 {
+		t.Fatalf("Expected value untouched but got %v", got)
+	}
+}
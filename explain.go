@@ -0,0 +1,144 @@
+package db
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ExplainResult summary of the plan chosen by the server for a query
+type ExplainResult struct {
+	// Stages of the winning plan from the root stage down to the leaf
+	Stages         []string      `json:"stages"`
+	IndexName      string        `json:"indexName,omitempty"`
+	CollectionScan bool          `json:"collectionScan"`
+	KeysExamined   int           `json:"keysExamined"`
+	DocsExamined   int           `json:"docsExamined"`
+	DocsReturned   int           `json:"docsReturned"`
+	ExecutionTime  time.Duration `json:"executionTime"`
+}
+
+// explainOutput part of the explain command output we read
+type explainOutput struct {
+	QueryPlanner struct {
+		WinningPlan bson.M `bson:"winningPlan"`
+	} `bson:"queryPlanner"`
+	ExecutionStats struct {
+		NReturned           int `bson:"nReturned"`
+		ExecutionTimeMillis int `bson:"executionTimeMillis"`
+		TotalKeysExamined   int `bson:"totalKeysExamined"`
+		TotalDocsExamined   int `bson:"totalDocsExamined"`
+	} `bson:"executionStats"`
+}
+
+// WithSlowOperationThreshold log operations taking longer than threshold
+// with their collection, filter shape and duration
+func WithSlowOperationThreshold(threshold time.Duration) Option {
+	return WithMiddleware(func(call *Call, next Invoker) (interface{}, error) {
+		start := time.Now()
+		result, err := next(call)
+		if duration := time.Since(start); duration >= threshold {
+			shape, _ := json.Marshal(filterShape(call.Filter))
+			log.Printf("[App.db]: Slow operation %s on %s.%s took %s, filter %s\n", call.Operation, call.Database, call.DataName, duration, shape)
+		}
+		return result, err
+	})
+}
+
+// Explain get the plan used to find items matching filter sorted by sort
+// fields, prefixed with "-" for descending order
+func (m *mongoHandler) Explain(dataName string, filter map[string]interface{}, sort ...string) (ExplainResult, error) {
+	call := &Call{Operation: OperationExplain, DataName: dataName, Filter: filter}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.explain(call.DataName, call.Filter, sort...)
+	})
+	explained, _ := result.(ExplainResult)
+	return explained, err
+}
+
+func (m *mongoHandler) explain(dataName string, filter map[string]interface{}, sort ...string) (ExplainResult, error) {
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
+		return ExplainResult{}, err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	find := bson.D{
+		{Key: "find", Value: dataName},
+		{Key: "filter", Value: m.scopeFilter(dataName, filter)},
+	}
+	if len(sort) > 0 {
+		find = append(find, bson.E{Key: "sort", Value: sortDocument(sort...)})
+	}
+	explain := bson.D{
+		{Key: "explain", Value: find},
+		{Key: "verbosity", Value: "executionStats"},
+	}
+	if maxTime := m.readMaxTime(); maxTime > 0 {
+		explain = append(explain, bson.E{Key: "maxTimeMS", Value: int64(maxTime / time.Millisecond)})
+	}
+	var output explainOutput
+	err = m.root().connection.Database(m.database).RunCommand(ctx, explain).Decode(&output)
+	if err != nil {
+		log.Printf("[App.db]: Error during explain query on %s: %s\n", dataName, err)
+		return ExplainResult{}, err
+	}
+	return output.result(), nil
+}
+
+func (output explainOutput) result() ExplainResult {
+	result := ExplainResult{
+		KeysExamined:  output.ExecutionStats.TotalKeysExamined,
+		DocsExamined:  output.ExecutionStats.TotalDocsExamined,
+		DocsReturned:  output.ExecutionStats.NReturned,
+		ExecutionTime: time.Duration(output.ExecutionStats.ExecutionTimeMillis) * time.Millisecond,
+	}
+	stage := output.QueryPlanner.WinningPlan
+	// Plans of the slot based engine wrap the classic plan
+	if queryPlan, ok := stage["queryPlan"].(bson.M); ok {
+		stage = queryPlan
+	}
+	for stage != nil {
+		name, _ := stage["stage"].(string)
+		result.Stages = append(result.Stages, name)
+		switch name {
+		case "COLLSCAN":
+			result.CollectionScan = true
+		case "IXSCAN":
+			result.IndexName, _ = stage["indexName"].(string)
+		}
+		stage = nextStage(stage)
+	}
+	return result
+}
+
+// nextStage get the input of a plan stage, the first one when it has several
+func nextStage(stage bson.M) bson.M {
+	if input, ok := stage["inputStage"].(bson.M); ok {
+		return input
+	}
+	if inputs, ok := stage["inputStages"].([]interface{}); ok && len(inputs) > 0 {
+		input, _ := inputs[0].(bson.M)
+		return input
+	}
+	return nil
+}
+
+// sortDocument build a sort document from fields prefixed with "-" for
+// descending order and optionally "+" for ascending order
+func sortDocument(fields ...string) bson.D {
+	sort := make(bson.D, 0, len(fields))
+	for _, field := range fields {
+		order := 1
+		if strings.HasPrefix(field, "-") {
+			order = -1
+		}
+		sort = append(sort, bson.E{Key: strings.TrimLeft(field, "+-"), Value: order})
+	}
+	return sort
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestSortDocument(t *testing.T) {
+	expected := bson.D{{Key: "createdAt", Value: -1}, {Key: "actorID", Value: 1}, {Key: "seen", Value: 1}}
+	if sort := sortDocument("-createdAt", "+actorID", "seen"); !reflect.DeepEqual(sort, expected) {
+		t.Fatalf("Expected %v but got %v", expected, sort)
+	}
+}
+
+func TestExplainOutputResult(t *testing.T) {
+	var output explainOutput
+	output.QueryPlanner.WinningPlan = bson.M{
+		"queryPlan": bson.M{
+			"stage": "FETCH",
+			"inputStage": bson.M{
+				"stage":     "IXSCAN",
+				"indexName": "actorID_1",
+			},
+		},
+	}
+	output.ExecutionStats.NReturned = 2
+	output.ExecutionStats.TotalKeysExamined = 2
+	output.ExecutionStats.TotalDocsExamined = 2
+	output.ExecutionStats.ExecutionTimeMillis = 3
+	expected := ExplainResult{
+		Stages:        []string{"FETCH", "IXSCAN"},
+		IndexName:     "actorID_1",
+		KeysExamined:  2,
+		DocsExamined:  2,
+		DocsReturned:  2,
+		ExecutionTime: 3 * time.Millisecond,
+	}
+	if result := output.result(); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, result)
+	}
+}
+
+func TestSlowOperationThreshold(t *testing.T) {
+	var buffer bytes.Buffer
+	log.SetOutput(&buffer)
+	defer log.SetOutput(os.Stderr)
+	dbhandler := &mongoHandler{database: dbName}
+	WithSlowOperationThreshold(10 * time.Millisecond)(dbhandler)
+	filter := map[string]interface{}{"actorID": 1}
+	dbhandler.intercept(&Call{Operation: OperationFindBy, DataName: collectionName, Filter: filter}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, nil
+	})
+	if buffer.Len() != 0 {
+		t.Fatalf("Fast operations must not be logged, got %s", buffer.String())
+	}
+	dbhandler.intercept(&Call{Operation: OperationFindBy, DataName: collectionName, Filter: filter}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		time.Sleep(20 * time.Millisecond)
+		return nil, nil
+	})
+	logged := buffer.String()
+	if !strings.Contains(logged, "Slow operation FindBy on "+dbName+"."+collectionName) || !strings.Contains(logged, `{"actorID":"?"}`) {
+		t.Fatalf("Slow operation must be logged with its filter shape, got %s", logged)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	filter := map[string]interface{}{"actorID": 1}
+	result, err := dbhandler.Explain(collectionName, filter, "-createdAt")
+	if err != nil {
+		t.Fatalf("Explain must not return error but got %s", err.Error())
+	}
+	if !result.CollectionScan || result.DocsReturned != 2 || result.DocsExamined != 3 {
+		t.Fatalf("Expected a collection scan returning 2 of 3 documents, got %+v", result)
+	}
+	index := mongo.IndexModel{Keys: bson.D{{Key: "actorID", Value: 1}, {Key: "createdAt", Value: -1}}}
+	_, err = dbhandler.connection.Database(dbhandler.database).Collection(collectionName).Indexes().CreateOne(context.Background(), index)
+	if err != nil {
+		t.Fatalf("Fail to create index: %s", err.Error())
+	}
+	result, err = dbhandler.Explain(collectionName, filter, "-createdAt")
+	if err != nil {
+		t.Fatalf("Explain must not return error but got %s", err.Error())
+	}
+	if result.CollectionScan || result.IndexName != "actorID_1_createdAt_-1" || result.DocsExamined != 2 {
+		t.Fatalf("Expected an index scan examining 2 documents, got %+v", result)
+	}
+}
@@ -0,0 +1,355 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidFilter is returned when a filter has a wrong field name or
+// operator
+var ErrInvalidFilter = errors.New("Wrong filter")
+
+// comparisonOperators operators comparing a field with a value
+var comparisonOperators = map[string]bool{
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true, "$in": true, "$nin": true,
+}
+
+// queryOperators operators accepted in filters
+var queryOperators = map[string]bool{
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true, "$in": true, "$nin": true,
+	"$and": true, "$or": true, "$nor": true, "$not": true,
+	"$exists": true, "$type": true, "$regex": true, "$options": true,
+	"$elemMatch": true, "$size": true, "$all": true, "$mod": true,
+}
+
+// Filter typed query filter. Build it with Eq, In, And... then pass its Map
+// to handler methods taking a filter or a selector
+type Filter struct {
+	doc        map[string]interface{}
+	err        error
+	references []string
+}
+
+// Eq match items whose field equals value. Maps are compared as documents,
+// never read as operators
+func Eq(field string, value interface{}) Filter {
+	return Where(field, "$eq", value)
+}
+
+// Ne match items whose field differs from value
+func Ne(field string, value interface{}) Filter {
+	return Where(field, "$ne", value)
+}
+
+// Gt match items whose field is greater than value
+func Gt(field string, value interface{}) Filter {
+	return Where(field, "$gt", value)
+}
+
+// Gte match items whose field is greater than or equal to value
+func Gte(field string, value interface{}) Filter {
+	return Where(field, "$gte", value)
+}
+
+// Lt match items whose field is less than value
+func Lt(field string, value interface{}) Filter {
+	return Where(field, "$lt", value)
+}
+
+// Lte match items whose field is less than or equal to value
+func Lte(field string, value interface{}) Filter {
+	return Where(field, "$lte", value)
+}
+
+// In match items whose field equals one of values
+func In(field string, values ...interface{}) Filter {
+	return Where(field, "$in", values)
+}
+
+// Nin match items whose field equals none of values
+func Nin(field string, values ...interface{}) Filter {
+	return Where(field, "$nin", values)
+}
+
+// Exists match items having field, or not having it
+func Exists(field string, exists bool) Filter {
+	return Where(field, "$exists", exists)
+}
+
+// Regex match items whose field matches pattern, options are regex flags
+// among i, m, s and x
+func Regex(field, pattern, options string) Filter {
+	if strings.Trim(options, "imsx") != "" {
+		return Filter{err: fmt.Errorf("%w: regex options %q of %s, allowed flags are i, m, s and x", ErrInvalidFilter, options, field)}
+	}
+	return Where(field, "$regex", primitive.Regex{Pattern: pattern, Options: options})
+}
+
+// DateRange match items whose field is in [from, to). A zero bound leaves the
+// range open on that side
+func DateRange(field string, from, to time.Time) Filter {
+	operators := make(map[string]interface{}, 2)
+	if !from.IsZero() {
+		operators["$gte"] = from
+	}
+	if !to.IsZero() {
+		operators["$lt"] = to
+	}
+	if len(operators) == 0 {
+		return Filter{err: fmt.Errorf("%w: date range of %s has no bound", ErrInvalidFilter, field)}
+	}
+	if err := validateFilterField(field); err != nil {
+		return Filter{err: err}
+	}
+	return Filter{doc: map[string]interface{}{field: operators}}
+}
+
+// ElemMatch match items whose array field has an element matching filter.
+// References of filter are fields of the elements
+func ElemMatch(field string, filter Filter) Filter {
+	if filter.err != nil {
+		return filter
+	}
+	matched := Where(field, "$elemMatch", filter.doc)
+	for _, reference := range filter.references {
+		matched.references = append(matched.references, field+"."+reference)
+	}
+	return matched
+}
+
+// Where match items comparing field with value using operator, e.g. "$gte".
+// The operator must be a comparison or element operator
+func Where(field, operator string, value interface{}) Filter {
+	if err := validateFilterField(field); err != nil {
+		return Filter{err: err}
+	}
+	switch {
+	case comparisonOperators[operator]:
+	case operator == "$exists", operator == "$type", operator == "$regex", operator == "$elemMatch",
+		operator == "$size", operator == "$all", operator == "$mod":
+	default:
+		return Filter{err: fmt.Errorf("%w: unknown operator %q on %s", ErrInvalidFilter, operator, field)}
+	}
+	return Filter{doc: map[string]interface{}{field: map[string]interface{}{operator: value}}}
+}
+
+// And match items matching all filters
+func And(filters ...Filter) Filter {
+	return combine("$and", filters)
+}
+
+// Or match items matching at least one of filters
+func Or(filters ...Filter) Filter {
+	return combine("$or", filters)
+}
+
+// Not match items not matching filter
+func Not(filter Filter) Filter {
+	return combine("$nor", []Filter{filter})
+}
+
+func combine(operator string, filters []Filter) Filter {
+	if len(filters) == 0 {
+		return Filter{err: fmt.Errorf("%w: %s needs at least one filter", ErrInvalidFilter, operator)}
+	}
+	combined := Filter{}
+	clauses := make([]interface{}, len(filters))
+	for index, filter := range filters {
+		if filter.err != nil {
+			return filter
+		}
+		clause := filter.doc
+		if clause == nil {
+			clause = map[string]interface{}{}
+		}
+		clauses[index] = clause
+		combined.references = append(combined.references, filter.references...)
+	}
+	combined.doc = map[string]interface{}{operator: clauses}
+	return combined
+}
+
+// WithReferences declare fields of a collection holding ObjectIds, hex
+// strings compared with them in filters and selectors are converted. Fields
+// of array elements are named after the array, e.g. comments.authorID
+func WithReferences(dataName string, fields ...string) Option {
+	return func(m *mongoHandler) {
+		config := m.collectionConfig(dataName)
+		config.references = append(config.references, fields...)
+	}
+}
+
+// referencesOf get reference fields declared for a collection, nil when none
+func (m *mongoHandler) referencesOf(dataName string) map[string]bool {
+	fields := m.configOf(dataName).references
+	if len(fields) == 0 {
+		return nil
+	}
+	references := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		references[field] = true
+	}
+	return references
+}
+
+// References declare fields holding ObjectIds for this filter only, hex
+// strings compared with them are converted like for _id. Use WithReferences
+// to declare them once for a collection
+func (f Filter) References(fields ...string) Filter {
+	f.references = append(append([]string{}, f.references...), fields...)
+	return f
+}
+
+// Map get the filter as accepted by handler methods. The zero Filter matches
+// every item
+func (f Filter) Map() (map[string]interface{}, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	references := map[string]bool{"_id": true}
+	for _, field := range f.references {
+		references[field] = true
+	}
+	return convertReferences(f.doc, references, ""), nil
+}
+
+// convertReferences copy doc converting hex strings compared with reference
+// fields to ObjectIds. prefix is the path of the array whose elements are
+// matched by doc
+func convertReferences(doc map[string]interface{}, references map[string]bool, prefix string) map[string]interface{} {
+	converted := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		switch {
+		case key == "$and" || key == "$or" || key == "$nor":
+			clauses, ok := toArray(value)
+			if !ok {
+				converted[key] = value
+				continue
+			}
+			convertedClauses := make([]interface{}, len(clauses))
+			for index, clause := range clauses {
+				if clauseDoc, ok := toDocument(clause); ok {
+					clause = convertReferences(clauseDoc, references, prefix)
+				}
+				convertedClauses[index] = clause
+			}
+			converted[key] = convertedClauses
+		case references[prefix+key]:
+			converted[key] = referenceValue(value)
+		default:
+			converted[key] = elemMatchReferences(value, references, prefix+key+".")
+		}
+	}
+	return converted
+}
+
+// elemMatchReferences convert references of the elements matched by the
+// $elemMatch operator of value
+func elemMatchReferences(value interface{}, references map[string]bool, prefix string) interface{} {
+	operators, ok := toDocument(value)
+	if !ok {
+		return value
+	}
+	match, ok := toDocument(operators["$elemMatch"])
+	if !ok {
+		return value
+	}
+	converted := cloneStringMap(operators)
+	converted["$elemMatch"] = convertReferences(match, references, prefix)
+	return converted
+}
+
+// referenceValue convert hex strings of value to ObjectIds, in operands of
+// comparison operators as well
+func referenceValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if objectID, err := primitive.ObjectIDFromHex(v); err == nil {
+			return objectID
+		}
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for index, item := range v {
+			values[index] = referenceValue(item)
+		}
+		return values
+	case map[string]interface{}:
+		operators := make(map[string]interface{}, len(v))
+		for operator, operand := range v {
+			if comparisonOperators[operator] || operator == "$elemMatch" {
+				operand = referenceValue(operand)
+			}
+			operators[operator] = operand
+		}
+		return operators
+	}
+	return value
+}
+
+// ValidateFilter check a raw filter only uses known operators and field
+// names without surrounding spaces, catching typos such as "$gte "
+func ValidateFilter(filter map[string]interface{}) error {
+	return validateFilterDoc(filter, "")
+}
+
+func validateFilterDoc(doc map[string]interface{}, path string) error {
+	for key, value := range doc {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+		if strings.HasPrefix(key, "$") {
+			if !queryOperators[key] {
+				return fmt.Errorf("%w: unknown operator %q at %s", ErrInvalidFilter, key, keyPath)
+			}
+		} else if err := validateFilterField(key); err != nil {
+			return err
+		}
+		if err := validateFilterValue(value, keyPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateFilterValue(value interface{}, path string) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateFilterDoc(v, path)
+	case primitive.M:
+		return validateFilterDoc(v, path)
+	case primitive.A:
+		return validateFilterValue([]interface{}(v), path)
+	case []interface{}:
+		for index, item := range v {
+			if err := validateFilterValue(item, path+"."+strconv.Itoa(index)); err != nil {
+				return err
+			}
+		}
+	case []map[string]interface{}:
+		for index, item := range v {
+			if err := validateFilterDoc(item, path+"."+strconv.Itoa(index)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateFilterField check a field name of a filter
+func validateFilterField(field string) error {
+	if validateFieldName(field) != nil || strings.TrimSpace(field) != field {
+		return fmt.Errorf("%w: field name %q", ErrInvalidFilter, field)
+	}
+	for _, part := range strings.Split(field, ".") {
+		if part == "" {
+			return fmt.Errorf("%w: field name %q", ErrInvalidFilter, field)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFilterMap(t *testing.T) {
+	from := time.Date(2018, 9, 1, 0, 0, 0, 0, time.UTC)
+	filter := And(
+		Eq("category", "comment"),
+		Or(Gt("actorID", 1), In("targetUserID", 1, 2)),
+		Not(Regex("content", "^spam", "i")),
+		DateRange("createdAt", from, time.Time{}),
+		Exists("deletedAt", false),
+	)
+	expected := map[string]interface{}{
+		"$and": []interface{}{
+			map[string]interface{}{"category": map[string]interface{}{"$eq": "comment"}},
+			map[string]interface{}{"$or": []interface{}{
+				map[string]interface{}{"actorID": map[string]interface{}{"$gt": 1}},
+				map[string]interface{}{"targetUserID": map[string]interface{}{"$in": []interface{}{1, 2}}},
+			}},
+			map[string]interface{}{"$nor": []interface{}{
+				map[string]interface{}{"content": map[string]interface{}{"$regex": primitive.Regex{Pattern: "^spam", Options: "i"}}},
+			}},
+			map[string]interface{}{"createdAt": map[string]interface{}{"$gte": from}},
+			map[string]interface{}{"deletedAt": map[string]interface{}{"$exists": false}},
+		},
+	}
+	got, err := filter.Map()
+	if err != nil {
+		t.Fatalf("Filter must be valid but got %s", err.Error())
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v but got %v", expected, got)
+	}
+	if got, err := (Filter{}).Map(); err != nil || len(got) != 0 {
+		t.Fatalf("Zero filter must match every item, got %v and %v", got, err)
+	}
+}
+
+func TestFilterReferences(t *testing.T) {
+	id := "5b8f5bd2a7e3b5a0c4a1f001"
+	objectID, _ := primitive.ObjectIDFromHex(id)
+	filter := Or(Eq("_id", id), In("parentID", id, "not-an-id"), Eq("content", id)).References("parentID")
+	expected := map[string]interface{}{
+		"$or": []interface{}{
+			map[string]interface{}{"_id": map[string]interface{}{"$eq": objectID}},
+			map[string]interface{}{"parentID": map[string]interface{}{"$in": []interface{}{objectID, "not-an-id"}}},
+			map[string]interface{}{"content": map[string]interface{}{"$eq": id}},
+		},
+	}
+	if got, _ := filter.Map(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v but got %v", expected, got)
+	}
+}
+
+func TestFilterElemMatchReferences(t *testing.T) {
+	id := "5b8f5bd2a7e3b5a0c4a1f001"
+	objectID, _ := primitive.ObjectIDFromHex(id)
+	filter := And(ElemMatch("comments", Eq("authorID", id).References("authorID")), Where("likedBy", "$elemMatch", map[string]interface{}{"$eq": id})).References("likedBy")
+	expected := map[string]interface{}{
+		"$and": []interface{}{
+			map[string]interface{}{"comments": map[string]interface{}{"$elemMatch": map[string]interface{}{"authorID": map[string]interface{}{"$eq": objectID}}}},
+			map[string]interface{}{"likedBy": map[string]interface{}{"$elemMatch": map[string]interface{}{"$eq": objectID}}},
+		},
+	}
+	if got, _ := filter.Map(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v but got %v", expected, got)
+	}
+}
+
+func TestCollectionReferences(t *testing.T) {
+	id := "5b8f5bd2a7e3b5a0c4a1f001"
+	objectID, _ := primitive.ObjectIDFromHex(id)
+	dbhandler := &mongoHandler{}
+	WithReferences(collectionName, "parentID", "comments.authorID")(dbhandler)
+	filters := map[string]interface{}{
+		"parentID": id,
+		"comments": map[string]interface{}{"$elemMatch": map[string]interface{}{"authorID": id}},
+		"content":  id,
+	}
+	expected := map[string]interface{}{
+		"parentID": objectID,
+		"comments": map[string]interface{}{"$elemMatch": map[string]interface{}{"authorID": objectID}},
+		"content":  id,
+	}
+	if got := dbhandler.scopeFilter(collectionName, filters); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v but got %v", expected, got)
+	}
+	if filters["parentID"] != id {
+		t.Fatalf("Filters of callers must not be modified")
+	}
+	if got := dbhandler.scopeFilter("other", filters); !reflect.DeepEqual(got, filters) {
+		t.Fatalf("References must only be converted in their collection, got %v", got)
+	}
+	clauses := []map[string]interface{}{{"parentID": id}, {"content": "hello"}}
+	for _, or := range []interface{}{clauses, bson.A{clauses[0], bson.M{"content": "hello"}}} {
+		expected := map[string]interface{}{"$or": []interface{}{map[string]interface{}{"parentID": objectID}, map[string]interface{}{"content": "hello"}}}
+		if got := dbhandler.scopeFilter(collectionName, map[string]interface{}{"$or": or}); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("Clauses %v must be converted, expected %v but got %v", or, expected, got)
+		}
+	}
+	if got := dbhandler.scopeFilter(collectionName, map[string]interface{}{"$or": "unknown"}); got["$or"] != "unknown" {
+		t.Fatalf("Unknown clauses must be kept, got %v", got)
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	filters := []Filter{
+		Eq("", 1),
+		Eq("$where", "sleep(1000)"),
+		Gte("createdAt ", time.Now()),
+		Eq("a..b", 1),
+		Where("count", "$gte ", 1),
+		Regex("content", "^a", "g"),
+		DateRange("createdAt", time.Time{}, time.Time{}),
+		Or(),
+		And(Eq("seen", true), Where("seen", "$where", 1)),
+		ElemMatch("tags", Eq("", 1)),
+	}
+	for _, filter := range filters {
+		if _, err := filter.Map(); !errors.Is(err, ErrInvalidFilter) {
+			t.Fatalf("Filter must return ErrInvalidFilter but got %v", err)
+		}
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	valid := map[string]interface{}{
+		"seen":    false,
+		"actorID": map[string]interface{}{"$gte": 1, "$lt": 10},
+		"$or":     []interface{}{map[string]interface{}{"category": "like"}, map[string]interface{}{"tags": map[string]interface{}{"$elemMatch": map[string]interface{}{"name": "go"}}}},
+	}
+	if err := ValidateFilter(valid); err != nil {
+		t.Fatalf("Filter must be valid but got %s", err.Error())
+	}
+	invalid := []map[string]interface{}{
+		{"actorID": map[string]interface{}{"$gte ": 1}},
+		{"$or": []interface{}{map[string]interface{}{"category": map[string]interface{}{"$equals": "like"}}}},
+		{"$where": "this.seen"},
+		{" seen": true},
+	}
+	for _, filter := range invalid {
+		if err := ValidateFilter(filter); !errors.Is(err, ErrInvalidFilter) {
+			t.Fatalf("Filter %v must return ErrInvalidFilter but got %v", filter, err)
+		}
+	}
+}
+
+func TestFilterQuery(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	filter, err := And(Eq("category", "comment"), Gt("actorID", 1)).Map()
+	if err != nil {
+		t.Fatalf("Filter must be valid but got %s", err.Error())
+	}
+	items, err := dbhandler.GetAllItemsNoLimit(collectionName, filter)
+	if err != nil || len(items) != 1 || items[0]["content"] != "Second fixture message" {
+		t.Fatalf("Expected the second fixture message but got %v and %v", items, err)
+	}
+	filter, _ = Eq("_id", fixtureFirstMessageID).Map()
+	if found, err := dbhandler.FindBy(collectionName, filter); err != nil || found["_id"] != fixtureFirstMessageID {
+		t.Fatalf("Hex ids must be converted to find the first fixture message, got %v and %v", found, err)
+	}
+}
@@ -1,5 +1,7 @@
 package db
 
+import "go.mongodb.org/mongo-driver/bson"
+
 func cloneStringMap(source map[string]interface{}) map[string]interface{} {
 	resultMap := make(map[string]interface{})
 	for key, value := range source {
@@ -7,3 +9,47 @@ func cloneStringMap(source map[string]interface{}) map[string]interface{} {
 	}
 	return resultMap
 }
+
+// filterShape replace values of a filter by "?" keeping field names and
+// operators, so it can be logged or traced without leaking data
+func filterShape(filter interface{}) interface{} {
+	switch value := filter.(type) {
+	case map[string]interface{}:
+		shape := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			shape[key] = filterShape(item)
+		}
+		return shape
+	case bson.M:
+		return filterShape(map[string]interface{}(value))
+	case bson.D:
+		shape := make(map[string]interface{}, len(value))
+		for _, item := range value {
+			shape[item.Key] = filterShape(item.Value)
+		}
+		return shape
+	case bson.A:
+		return filterShape([]interface{}(value))
+	case []interface{}:
+		// Keep structure of $and/$or/$nor clauses, hide plain value lists
+		for _, item := range value {
+			if _, ok := item.(map[string]interface{}); !ok {
+				if _, ok := item.(bson.M); !ok {
+					return "?"
+				}
+			}
+		}
+		shape := make([]interface{}, len(value))
+		for index, item := range value {
+			shape[index] = filterShape(item)
+		}
+		return shape
+	case []map[string]interface{}:
+		shape := make([]interface{}, len(value))
+		for index, item := range value {
+			shape[index] = filterShape(item)
+		}
+		return shape
+	}
+	return "?"
+}
@@ -0,0 +1,301 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// historySuffix is appended to a collection name to get its history collection
+const historySuffix = "_history"
+
+// Operations recorded in revision history
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionUpsert  = "upsert"
+	RevisionRemove  = "remove"
+	RevisionRestore = "restore"
+	RevisionPurge   = "purge"
+	RevisionRevert  = "revert"
+)
+
+// Revision snapshot of an item before and after a mutation
+type Revision struct {
+	ID        string                 `json:"_id"`
+	ItemID    string                 `json:"itemID"`
+	Operation string                 `json:"operation"`
+	Actor     string                 `json:"actor,omitempty"`
+	At        time.Time              `json:"at"`
+	Before    map[string]interface{} `json:"before,omitempty"`
+	After     map[string]interface{} `json:"after,omitempty"`
+}
+
+// revisionDoc revision as stored in history collections
+type revisionDoc struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	ItemID    primitive.ObjectID `bson:"itemID"`
+	Operation string             `bson:"operation"`
+	Actor     string             `bson:"actor,omitempty"`
+	At        time.Time          `bson:"at"`
+	Before    bson.M             `bson:"before,omitempty"`
+	After     bson.M             `bson:"after,omitempty"`
+}
+
+// WithHistory record revisions of every mutation of the given collections
+// into <collection>_history
+func WithHistory(dataNames ...string) Option {
+	return func(m *mongoHandler) {
+		for _, dataName := range dataNames {
+			m.collectionConfig(dataName).history = true
+		}
+	}
+}
+
+// revisionTracker snapshots items before a mutation so their revisions can
+// be written once the mutation succeeded. A nil tracker tracks nothing.
+// Tracking is best effort: snapshots and mutation are not atomic
+type revisionTracker struct {
+	handler   *mongoHandler
+	ctx       context.Context
+	c         *mongo.Collection
+	operation string
+	ids       []primitive.ObjectID
+	before    map[primitive.ObjectID]bson.M
+}
+
+// trackRevisions snapshot up to limit items matching selector (no limit when
+// 0) when the collection keeps history. A nil selector tracks no item yet,
+// ids are then registered with add
+func (m *mongoHandler) trackRevisions(ctx context.Context, c *mongo.Collection, dataName, operation string, selector map[string]interface{}, limit int) (*revisionTracker, error) {
+	if !m.configOf(dataName).history {
+		return nil, nil
+	}
+	tracker := &revisionTracker{
+		handler:   m,
+		ctx:       ctx,
+		c:         c,
+		operation: operation,
+		before:    make(map[primitive.ObjectID]bson.M),
+	}
+	if selector == nil {
+		return tracker, nil
+	}
+	var docs []bson.M
+	err := m.findAll(ctx, c, selector, &docs, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		log.Printf("[App.db]: Error during snapshot items of %s. %s\n", dataName, err)
+		return nil, err
+	}
+	for _, doc := range docs {
+		if id, ok := doc["_id"].(primitive.ObjectID); ok {
+			tracker.ids = append(tracker.ids, id)
+			tracker.before[id] = doc
+		}
+	}
+	return tracker, nil
+}
+
+// selector restrict selector to tracked items so the mutation touches
+// exactly the snapshotted items
+func (t *revisionTracker) selector(selector map[string]interface{}) map[string]interface{} {
+	if t == nil {
+		return selector
+	}
+	return bson.M{"$and": []interface{}{selector, bson.M{"_id": bson.M{"$in": t.ids}}}}
+}
+
+// add track an item which did not exist before the mutation
+func (t *revisionTracker) add(id primitive.ObjectID) {
+	if t != nil {
+		t.ids = append(t.ids, id)
+	}
+}
+
+// record write revisions of tracked items with their state after the
+// mutation. The mutation already happened, so failures are only logged
+func (t *revisionTracker) record() {
+	if t == nil || len(t.ids) == 0 {
+		return
+	}
+	var docs []bson.M
+	err := t.handler.findAll(t.ctx, t.c, bson.M{"_id": bson.M{"$in": t.ids}}, &docs)
+	if err != nil {
+		log.Printf("[App.db]: Error during snapshot items of %s. %s\n", t.c.Name(), err)
+		return
+	}
+	after := make(map[primitive.ObjectID]bson.M, len(docs))
+	for _, doc := range docs {
+		if id, ok := doc["_id"].(primitive.ObjectID); ok {
+			after[id] = doc
+		}
+	}
+	at := t.handler.now()
+	revisions := make([]interface{}, len(t.ids))
+	for index, id := range t.ids {
+		revisions[index] = revisionDoc{
+			ID:        primitive.NewObjectID(),
+			ItemID:    id,
+			Operation: t.operation,
+			Actor:     t.handler.actor,
+			At:        at,
+			Before:    t.before[id],
+			After:     after[id],
+		}
+	}
+	_, err = t.handler.collection(t.c.Name()+historySuffix).InsertMany(t.ctx, revisions)
+	if err != nil {
+		log.Printf("[App.db]: Error during write history of %s. %s\n", t.c.Name(), err)
+	}
+}
+
+// Revisions get revisions of an item, oldest first
+func (m *mongoHandler) Revisions(dataName string, id interface{}) ([]Revision, error) {
+	call := &Call{Operation: OperationRevisions, DataName: dataName, ID: id}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.revisions(call.DataName, call.ID)
+	})
+	revisions, _ := result.([]Revision)
+	return revisions, err
+}
+
+func (m *mongoHandler) revisions(dataName string, id interface{}) ([]Revision, error) {
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
+		return nil, err
+	}
+	// Make sure to use correct object id
+	objectID, err := createObjectID(id)
+	if err != nil {
+		log.Printf("[App.db]: Error during create object id %s. %s\n", id, err)
+		return nil, err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	history := m.collection(dataName + historySuffix)
+	var docs []revisionDoc
+	err = m.findAll(ctx, history, m.tenantRevisionFilter(bson.M{"itemID": objectID}), &docs, options.Find().SetSort(sortDocument("at", "_id")))
+	if err != nil {
+		log.Printf("[App.db]: Error during get revisions of %s. %s\n", id, err)
+		return nil, err
+	}
+	revisions := make([]Revision, len(docs))
+	for index, doc := range docs {
+		revisions[index] = doc.revision()
+	}
+	return revisions, nil
+}
+
+// RestoreRevision bring an item back to its state right after a revision,
+// recreating it when it was removed since. ErrNotFound is returned when the
+// item is out of the scope of the view, e.g. in the trash
+func (m *mongoHandler) RestoreRevision(dataName string, revisionID interface{}) error {
+	call := &Call{Operation: OperationRestoreRevision, DataName: dataName, ID: revisionID}
+	_, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, m.restoreRevision(call.DataName, call.ID)
+	})
+	return err
+}
+
+func (m *mongoHandler) restoreRevision(dataName string, revisionID interface{}) error {
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
+		return err
+	}
+	// Make sure to use correct object id
+	objectID, err := createObjectID(revisionID)
+	if err != nil {
+		log.Printf("[App.db]: Error during create object id %s. %s\n", revisionID, err)
+		return err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	var revision revisionDoc
+	err = m.findOne(ctx, m.collection(dataName+historySuffix), m.tenantRevisionFilter(bson.M{"_id": objectID}), &revision)
+	if err != nil {
+		log.Printf("[App.db]: Error during find revision %s. %s\n", revisionID, err)
+		return err
+	}
+	if revision.After == nil {
+		return errors.New("Revision has no snapshot to restore: item was removed by it")
+	}
+	snapshot, err := m.tenantDocument(revision.After)
+	if err != nil {
+		return err
+	}
+	snapshot = cloneStringMap(snapshot)
+	delete(snapshot, "_id")
+	field := m.versionFieldOf(dataName)
+	if field == "" {
+		return m.upsertSnapshot(ctx, c, dataName, revision.ItemID, snapshot)
+	}
+	selector := m.scopeFilter(dataName, bson.M{"_id": revision.ItemID})
+	return RetryOnConflict(DefaultConflictRetries, func() error {
+		var stored bson.M
+		err := m.findOne(ctx, c, selector, &stored, options.FindOne().SetProjection(bson.M{field: 1}))
+		if err == ErrNotFound {
+			recreated := cloneStringMap(snapshot)
+			recreated[field] = 1
+			return m.upsertSnapshot(ctx, c, dataName, revision.ItemID, recreated)
+		}
+		if err != nil {
+			return err
+		}
+		return m.replaceIfVersion(ctx, c, dataName, RevisionRevert, revision.ItemID, versionOf(stored, field), snapshot)
+	})
+}
+
+// upsertSnapshot replace an item in the scope of the view with a snapshot,
+// recreating it when it was removed. Items out of the scope, of another
+// tenant or in the trash, are not found
+func (m *mongoHandler) upsertSnapshot(ctx context.Context, c *mongo.Collection, dataName string, itemID primitive.ObjectID, snapshot map[string]interface{}) error {
+	selector := m.scopeFilter(dataName, bson.M{"_id": itemID})
+	tracker, err := m.trackRevisions(ctx, c, dataName, RevisionRevert, selector, 1)
+	if err != nil {
+		return err
+	}
+	if err = m.stampReplacement(ctx, c, dataName, itemID, snapshot); err != nil {
+		return err
+	}
+	_, err = c.ReplaceOne(ctx, selector, snapshot, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// The id is used by an item out of the scope
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if tracker != nil && len(tracker.ids) == 0 {
+		tracker.add(itemID)
+	}
+	tracker.record()
+	return nil
+}
+
+func (doc revisionDoc) revision() Revision {
+	revision := Revision{
+		ID:        doc.ID.Hex(),
+		ItemID:    doc.ItemID.Hex(),
+		Operation: doc.Operation,
+		Actor:     doc.Actor,
+		At:        doc.At,
+	}
+	if doc.Before != nil {
+		revision.Before = createMapFromBsonM(doc.Before)
+	}
+	if doc.After != nil {
+		revision.After = createMapFromBsonM(doc.After)
+	}
+	return revision
+}
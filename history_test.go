@@ -0,0 +1,177 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newHistoryTestHandler(t *testing.T) *mongoHandler {
+	dbhandler := newTestHandler(t, collectionName)
+	WithHistory(collectionName)(dbhandler)
+	return dbhandler
+}
+
+func TestAsActorView(t *testing.T) {
+	dbhandler := &mongoHandler{database: dbName}
+	view := dbhandler.AsActor("support").(*mongoHandler)
+	if view.parent != dbhandler || view.actor != "support" || dbhandler.actor != "" {
+		t.Fatalf("AsActor must create a view of the handler, got %+v", view)
+	}
+	nested := view.AsActor("admin").(*mongoHandler)
+	if nested.parent != dbhandler {
+		t.Fatalf("Views must share the root handler, got parent %p", nested.parent)
+	}
+	view.CloseConnection()
+}
+
+func TestHistoryRecordsMutations(t *testing.T) {
+	dbhandler := newHistoryTestHandler(t)
+	inserted, err := dbhandler.AsActor("worker").AddNewItem(collectionName, map[string]interface{}{"content": "This is test message", "targetUserID": 99})
+	if err != nil {
+		t.Fatalf("Insert item must not return error but got %s", err.Error())
+	}
+	_, err = dbhandler.AsActor("support").UpdateBy(collectionName, map[string]interface{}{"targetUserID": 99}, map[string]interface{}{"seen": true})
+	if err != nil {
+		t.Fatalf("Update by must not return error but got %s", err.Error())
+	}
+	err = dbhandler.RemoveItemByID(collectionName, inserted["_id"])
+	if err != nil {
+		t.Fatalf("Remove must not return error but got %s", err.Error())
+	}
+	revisions, err := dbhandler.Revisions(collectionName, inserted["_id"])
+	if err != nil {
+		t.Fatalf("Revisions must not return error but got %s", err.Error())
+	}
+	operations := make([]string, len(revisions))
+	for index, revision := range revisions {
+		operations[index] = revision.Operation
+	}
+	if expected := []string{RevisionInsert, RevisionUpdate, RevisionRemove}; !reflect.DeepEqual(operations, expected) {
+		t.Fatalf("Expected operations %v but got %v", expected, operations)
+	}
+	if revisions[0].Actor != "worker" || revisions[0].Before != nil || revisions[0].After["_id"] != inserted["_id"] {
+		t.Fatalf("Unexpected insert revision %+v", revisions[0])
+	}
+	if revisions[1].Actor != "support" || revisions[1].Before["seen"] != nil || revisions[1].After["seen"] != true {
+		t.Fatalf("Unexpected update revision %+v", revisions[1])
+	}
+	if revisions[2].Actor != "" || revisions[2].Before == nil || revisions[2].After != nil {
+		t.Fatalf("Unexpected remove revision %+v", revisions[2])
+	}
+}
+
+func TestHistoryUpdateByOnlyTouchesTrackedItems(t *testing.T) {
+	dbhandler := newHistoryTestHandler(t)
+	updated, err := dbhandler.UpdateBy(collectionName, map[string]interface{}{"actorID": 1}, map[string]interface{}{"seen": true})
+	if err != nil {
+		t.Fatalf("Update by must not return error but got %s", err.Error())
+	}
+	if updated != 2 {
+		t.Fatalf("Expected 2 updated items but got %d", updated)
+	}
+	for _, id := range []string{"5b8f5bd2a7e3b5a0c4a1f001", "5b8f5bd2a7e3b5a0c4a1f003"} {
+		revisions, err := dbhandler.Revisions(collectionName, id)
+		if err != nil {
+			t.Fatalf("Revisions must not return error but got %s", err.Error())
+		}
+		if len(revisions) != 1 || revisions[0].Before["seen"] != false || revisions[0].After["seen"] != true {
+			t.Fatalf("Unexpected revisions of %s: %+v", id, revisions)
+		}
+	}
+}
+
+func TestRestoreRevision(t *testing.T) {
+	dbhandler := newHistoryTestHandler(t)
+	err := dbhandler.UpdateByID(collectionName, fixtureFirstMessageID, map[string]interface{}{"content": "edited"})
+	if err != nil {
+		t.Fatalf("Update by id must not return error but got %s", err.Error())
+	}
+	err = dbhandler.RemoveItemByID(collectionName, fixtureFirstMessageID)
+	if err != nil {
+		t.Fatalf("Remove must not return error but got %s", err.Error())
+	}
+	revisions, err := dbhandler.Revisions(collectionName, fixtureFirstMessageID)
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("Expected 2 revisions but got %v, %v", revisions, err)
+	}
+	if err = dbhandler.RestoreRevision(collectionName, revisions[1].ID); err == nil {
+		t.Fatalf("Restoring a removal revision must return error")
+	}
+	if err = dbhandler.RestoreRevision(collectionName, revisions[0].ID); err != nil {
+		t.Fatalf("Restore revision must not return error but got %s", err.Error())
+	}
+	found, err := dbhandler.FindItemByID(collectionName, fixtureFirstMessageID)
+	if err != nil {
+		t.Fatalf("Restored item must be found but got %s", err.Error())
+	}
+	if found["content"] != "edited" {
+		t.Fatalf("Item must be restored to the revision state, got %v", found)
+	}
+	revisions, err = dbhandler.Revisions(collectionName, mustObjectID(fixtureFirstMessageID))
+	if err != nil || len(revisions) != 3 || revisions[2].Operation != RevisionRevert {
+		t.Fatalf("Restoring must be recorded as a revision, got %v, %v", revisions, err)
+	}
+}
+
+func TestHistoryFailureKeepsMutation(t *testing.T) {
+	dbhandler := newHistoryTestHandler(t)
+	// History collection rejecting every revision
+	rejectAll := map[string]interface{}{"never": map[string]interface{}{"$exists": true}}
+	if err := dbhandler.CreateCollection(collectionName+historySuffix, CollectionOptions{Validator: rejectAll}); err != nil {
+		t.Fatalf("Fail to create history collection: %s", err.Error())
+	}
+	inserted, err := dbhandler.AddNewItem(collectionName, map[string]interface{}{"content": "This is test message"})
+	if err != nil {
+		t.Fatalf("Failing to write history must not fail the insert, got %s", err.Error())
+	}
+	if _, err = dbhandler.FindItemByID(collectionName, inserted["_id"]); err != nil {
+		t.Fatalf("Inserted item must be found but got %s", err.Error())
+	}
+	if err = dbhandler.RemoveItemByID(collectionName, inserted["_id"]); err != nil {
+		t.Fatalf("Failing to write history must not fail the removal, got %s", err.Error())
+	}
+}
+
+func TestRestoreRevisionScope(t *testing.T) {
+	dbhandler := newHistoryTestHandler(t)
+	acme := dbhandler.ForTenant("acme")
+	inserted, err := acme.AddNewItem(collectionName, map[string]interface{}{"content": "hello"})
+	if err != nil {
+		t.Fatalf("Insert must not return error but got %s", err.Error())
+	}
+	revisions, err := acme.Revisions(collectionName, inserted["_id"])
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("Expected 1 revision but got %v, %v", revisions, err)
+	}
+	if _, err = dbhandler.UpdateBy(collectionName, map[string]interface{}{"_id": mustObjectID(inserted["_id"].(string))}, map[string]interface{}{DefaultTenantField: "globex"}); err != nil {
+		t.Fatalf("Update must not return error but got %s", err.Error())
+	}
+	if err = acme.RestoreRevision(collectionName, revisions[0].ID); err != ErrNotFound {
+		t.Fatalf("Restoring over an item of another tenant must return ErrNotFound but got %v", err)
+	}
+	found, err := dbhandler.FindItemByID(collectionName, inserted["_id"])
+	if err != nil || found[DefaultTenantField] != "globex" {
+		t.Fatalf("Items of other tenants must not be replaced, got %v and %v", found, err)
+	}
+}
+
+func TestRestoreRevisionVersion(t *testing.T) {
+	dbhandler := newHistoryTestHandler(t)
+	WithVersioning(collectionName)(dbhandler)
+	for _, content := range []string{"edited", "edited again"} {
+		if err := dbhandler.UpdateByID(collectionName, fixtureFirstMessageID, map[string]interface{}{"content": content}); err != nil {
+			t.Fatalf("Update by id must not return error but got %s", err.Error())
+		}
+	}
+	revisions, err := dbhandler.Revisions(collectionName, fixtureFirstMessageID)
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("Expected 2 revisions but got %v, %v", revisions, err)
+	}
+	if err = dbhandler.RestoreRevision(collectionName, revisions[0].ID); err != nil {
+		t.Fatalf("Restore revision must not return error but got %s", err.Error())
+	}
+	found, err := dbhandler.FindItemByID(collectionName, fixtureFirstMessageID)
+	if err != nil || found["content"] != "edited" || versionOf(found, DefaultVersionField) != 3 {
+		t.Fatalf("Restoring must bump the stored version, got %v and %v", found, err)
+	}
+}
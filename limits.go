@@ -0,0 +1,77 @@
+package db
+
+import (
+	"errors"
+	"log"
+	"math"
+)
+
+var (
+	// ErrResultTooLarge is returned when an unbounded read matches more
+	// documents than allowed, narrow the filter or page through results
+	ErrResultTooLarge = errors.New("Result too large, narrow the filter or use paging")
+	// ErrInvalidLimit is returned when a page size is lower than 1
+	ErrInvalidLimit = errors.New("Wrong limit, page size must be at least 1")
+	// ErrInvalidPage is returned when a page number is lower than 1 or too large
+	ErrInvalidPage = errors.New("Wrong page, pages start at 1")
+)
+
+// WithMaxResults set max number of documents returned by unbounded reads
+// such as GetAllItemsNoLimit, Distinct and CountBy. There is no limit unless
+// set
+func WithMaxResults(maxResults int) Option {
+	return func(m *mongoHandler) {
+		m.maxResults = maxResults
+	}
+}
+
+// WithMaxPageSize set max page size, larger limits are clamped. Pages are
+// not clamped unless set
+func WithMaxPageSize(maxPageSize int) Option {
+	return func(m *mongoHandler) {
+		m.maxPageSize = maxPageSize
+	}
+}
+
+// WithUnboundedReads disable result limits for the given collections, for
+// trusted batch jobs which need to read them at once
+func WithUnboundedReads(dataNames ...string) Option {
+	return func(m *mongoHandler) {
+		for _, dataName := range dataNames {
+			m.collectionConfig(dataName).unbounded = true
+		}
+	}
+}
+
+// maxResultsOf get max number of documents of an unbounded read on a
+// collection, 0 means no limit
+func (m *mongoHandler) maxResultsOf(dataName string) int {
+	if m.configOf(dataName).unbounded {
+		return 0
+	}
+	return m.maxResults
+}
+
+// pageLimit validate paging arguments and clamp limit to the max page size
+func (m *mongoHandler) pageLimit(dataName string, limit, page int) (int, error) {
+	if limit < 1 {
+		return 0, ErrInvalidLimit
+	}
+	if m.maxPageSize > 0 && limit > m.maxPageSize && !m.configOf(dataName).unbounded {
+		limit = m.maxPageSize
+	}
+	// Skip must stay a positive int32 for the server
+	if page < 1 || page > math.MaxInt32/limit {
+		return 0, ErrInvalidPage
+	}
+	return limit, nil
+}
+
+// checkResultSize fail reads returning more documents than max results
+func checkResultSize(dataName string, count, maxResults int) error {
+	if maxResults > 0 && count > maxResults {
+		log.Printf("[App.db]: Read on %s exceeds %d documents\n", dataName, maxResults)
+		return ErrResultTooLarge
+	}
+	return nil
+}
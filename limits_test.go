@@ -0,0 +1,62 @@
+package db
+
+import "testing"
+
+func TestPageLimit(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	WithMaxPageSize(50)(dbhandler)
+	WithUnboundedReads("batch")(dbhandler)
+	cases := []struct {
+		dataName    string
+		limit, page int
+		expected    int
+		err         error
+	}{
+		{collectionName, 10, 1, 10, nil},
+		{collectionName, 500, 2, 50, nil},
+		{"batch", 500, 2, 500, nil},
+		{collectionName, 0, 1, 0, ErrInvalidLimit},
+		{collectionName, -5, 1, 0, ErrInvalidLimit},
+		{collectionName, 10, 0, 0, ErrInvalidPage},
+		{collectionName, 10, -1, 0, ErrInvalidPage},
+		{collectionName, 50, 1 << 30, 0, ErrInvalidPage},
+	}
+	for _, c := range cases {
+		limit, err := dbhandler.pageLimit(c.dataName, c.limit, c.page)
+		if limit != c.expected || err != c.err {
+			t.Fatalf("Limit %d page %d on %s: expected %d, %v but got %d, %v", c.limit, c.page, c.dataName, c.expected, c.err, limit, err)
+		}
+	}
+	if limit, err := (&mongoHandler{}).pageLimit(collectionName, 5000, 1); limit != 5000 || err != nil {
+		t.Fatalf("Pages must not be clamped by default, got %d and %v", limit, err)
+	}
+}
+
+func TestMaxResults(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	if dbhandler.maxResultsOf(collectionName) != 0 {
+		t.Fatalf("Reads must not be limited by default")
+	}
+	WithMaxResults(2)(dbhandler)
+	if _, err := dbhandler.GetAllItemsNoLimit(collectionName, nil); err != ErrResultTooLarge {
+		t.Fatalf("Reading 3 documents with max results 2 must return ErrResultTooLarge but got %v", err)
+	}
+	if _, err := dbhandler.Distinct(collectionName, "_id", nil); err != ErrResultTooLarge {
+		t.Fatalf("Distinct over max results must return ErrResultTooLarge but got %v", err)
+	}
+	items, err := dbhandler.GetAllItemsNoLimit(collectionName, map[string]interface{}{"actorID": 1})
+	if err != nil || len(items) != 2 {
+		t.Fatalf("Reading up to max results must succeed, got %d items and %v", len(items), err)
+	}
+	WithUnboundedReads(collectionName)(dbhandler)
+	if items, err = dbhandler.GetAllItemsNoLimit(collectionName, nil); err != nil || len(items) != 3 {
+		t.Fatalf("Unbounded collections must return all items, got %d items and %v", len(items), err)
+	}
+}
+
+func TestGetAllItemsInvalidPage(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	if _, err := dbhandler.GetAllItems(collectionName, "DESC", "createdAt", 10, -1, nil); err != ErrInvalidPage {
+		t.Fatalf("Negative pages must return ErrInvalidPage but got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Metrics collects Prometheus metrics of handler operations. Register it
+// with a prometheus registry and pass it to handlers with WithMetrics
+type Metrics struct {
+	duration  *prometheus.HistogramVec
+	errors    *prometheus.CounterVec
+	inFlight  *prometheus.GaugeVec
+	documents *prometheus.HistogramVec
+	open      prometheus.Gauge
+	inUse     prometheus.Gauge
+}
+
+// NewMetrics create metrics named <namespace>_db_*
+func NewMetrics(namespace string) *Metrics {
+	labels := []string{"collection", "operation"}
+	return &Metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of database operations.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "operation_errors_total",
+			Help:      "Failed database operations by error class.",
+		}, append(labels, "class")),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "operations_in_flight",
+			Help:      "Database operations currently running.",
+		}, labels),
+		documents: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "documents_returned",
+			Help:      "Documents returned by read operations.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 10),
+		}, labels),
+		open: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "pool_connections_open",
+			Help:      "Connections open to database servers.",
+		}),
+		inUse: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "pool_connections_in_use",
+			Help:      "Connections currently checked out of the pool.",
+		}),
+	}
+}
+
+// WithMetrics instrument every operation of the handler and its connection
+// pool
+func WithMetrics(metrics *Metrics) Option {
+	middleware := WithMiddleware(metrics.Middleware())
+	return func(m *mongoHandler) {
+		m.poolMonitor = metrics.poolMonitor()
+		middleware(m)
+	}
+}
+
+// poolMonitor track connection pool events into the pool gauges
+func (metrics *Metrics) poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				metrics.open.Inc()
+			case event.ConnectionClosed:
+				metrics.open.Dec()
+			case event.GetSucceeded:
+				metrics.inUse.Inc()
+			case event.ConnectionReturned:
+				metrics.inUse.Dec()
+			}
+		},
+	}
+}
+
+// Middleware measure calls passing through it
+func (metrics *Metrics) Middleware() Middleware {
+	return func(call *Call, next Invoker) (interface{}, error) {
+		inFlight := metrics.inFlight.WithLabelValues(call.DataName, call.Operation)
+		inFlight.Inc()
+		defer inFlight.Dec()
+		start := time.Now()
+		result, err := next(call)
+		metrics.duration.WithLabelValues(call.DataName, call.Operation).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.errors.WithLabelValues(call.DataName, call.Operation, errorClass(err)).Inc()
+		} else if count, ok := documentCount(result); ok && isReadOperation(call.Operation) {
+			metrics.documents.WithLabelValues(call.DataName, call.Operation).Observe(float64(count))
+		}
+		return result, err
+	}
+}
+
+// Describe implements prometheus.Collector
+func (metrics *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	metrics.duration.Describe(ch)
+	metrics.errors.Describe(ch)
+	metrics.inFlight.Describe(ch)
+	metrics.documents.Describe(ch)
+	metrics.open.Describe(ch)
+	metrics.inUse.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (metrics *Metrics) Collect(ch chan<- prometheus.Metric) {
+	metrics.duration.Collect(ch)
+	metrics.errors.Collect(ch)
+	metrics.inFlight.Collect(ch)
+	metrics.documents.Collect(ch)
+	metrics.open.Collect(ch)
+	metrics.inUse.Collect(ch)
+}
+
+// errorClass classify errors into a small set of metric label values
+func errorClass(err error) string {
+	switch err {
+	case ErrNotFound:
+		return "not_found"
+	case ErrVersionConflict:
+		return "version_conflict"
+	case ErrSoftDeleteDisabled, ErrVersioningDisabled, ErrInvalidLimit, ErrInvalidPage, ErrInvalidReadPreference, ErrMatchAll:
+		return "invalid_argument"
+	case ErrResultTooLarge:
+		return "result_too_large"
+	case io.EOF:
+		return "network"
+	}
+	if errors.Is(err, ErrInvalidTenant) || errors.Is(err, ErrTenantMismatch) || errors.Is(err, ErrInvalidDatabase) || errors.Is(err, ErrInvalidCollection) || err == ErrSharedCollection {
+		return "invalid_argument"
+	}
+	if serverErr, ok := err.(mongo.ServerError); ok && serverErr.HasErrorCode(documentValidationFailure) {
+		return "invalid_argument"
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return "duplicate_key"
+	}
+	if mongo.IsTimeout(err) {
+		return "timeout"
+	}
+	if mongo.IsNetworkError(err) {
+		return "network"
+	}
+	switch e := err.(type) {
+	case InvalidObjectIDError, InjectionError, SchemaError:
+		return "invalid_argument"
+	case TimeoutError:
+		return "timeout"
+	case net.Error:
+		if e.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	case mongo.CommandError:
+		return "query"
+	case mongo.WriteException, mongo.BulkWriteException:
+		return "write"
+	}
+	return "other"
+}
+
+// documentCount count documents of a read result
+func documentCount(result interface{}) (int, bool) {
+	switch items := result.(type) {
+	case PagedResults:
+		return len(items.Items), true
+	case []map[string]interface{}:
+		return len(items), true
+	case map[string]interface{}:
+		return 1, true
+	case []interface{}:
+		return len(items), true
+	case []GroupCount:
+		return len(items), true
+	case []Revision:
+		return len(items), true
+	}
+	return 0, false
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	metrics := NewMetrics("test")
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(metrics); err != nil {
+		t.Fatalf("Metrics must be registrable but got %s", err.Error())
+	}
+	dbhandler := &mongoHandler{database: dbName}
+	WithMetrics(metrics)(dbhandler)
+	items := []map[string]interface{}{{"_id": "1"}, {"_id": "2"}}
+	dbhandler.intercept(&Call{Operation: OperationGetAllItemsNoLimit, DataName: collectionName}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		if inFlight := testutil.ToFloat64(metrics.inFlight.WithLabelValues(collectionName, OperationGetAllItemsNoLimit)); inFlight != 1 {
+			t.Fatalf("Expected 1 operation in flight but got %v", inFlight)
+		}
+		return items, nil
+	})
+	dbhandler.intercept(&Call{Operation: OperationFindItemByID, DataName: collectionName}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return map[string]interface{}{}, ErrNotFound
+	})
+	if inFlight := testutil.ToFloat64(metrics.inFlight.WithLabelValues(collectionName, OperationGetAllItemsNoLimit)); inFlight != 0 {
+		t.Fatalf("Expected no operation in flight but got %v", inFlight)
+	}
+	if count := testutil.CollectAndCount(metrics.duration); count != 2 {
+		t.Fatalf("Expected durations of 2 operations but got %d", count)
+	}
+	if errorsCount := testutil.ToFloat64(metrics.errors.WithLabelValues(collectionName, OperationFindItemByID, "not_found")); errorsCount != 1 {
+		t.Fatalf("Expected 1 not found error but got %v", errorsCount)
+	}
+	if count := testutil.CollectAndCount(metrics.documents); count != 1 {
+		t.Fatalf("Only successful reads must observe returned documents, got %d series", count)
+	}
+	if count := testutil.CollectAndCount(metrics, "test_db_pool_connections_open"); count != 1 {
+		t.Fatalf("Expected connection pool stats to be collected, got %d", count)
+	}
+}
+
+func TestMetricsPoolMonitor(t *testing.T) {
+	metrics := NewMetrics("test")
+	dbhandler := &mongoHandler{}
+	WithMetrics(metrics)(dbhandler)
+	if dbhandler.poolMonitor == nil {
+		t.Fatalf("WithMetrics must monitor the connection pool")
+	}
+	for _, eventType := range []string{event.ConnectionCreated, event.ConnectionCreated, event.GetSucceeded, event.ConnectionReturned, event.GetSucceeded, event.ConnectionClosed} {
+		dbhandler.poolMonitor.Event(&event.PoolEvent{Type: eventType})
+	}
+	if open := testutil.ToFloat64(metrics.open); open != 1 {
+		t.Fatalf("Expected 1 open connection but got %v", open)
+	}
+	if inUse := testutil.ToFloat64(metrics.inUse); inUse != 1 {
+		t.Fatalf("Expected 1 connection in use but got %v", inUse)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{ErrNotFound, "not_found"},
+		{ErrVersionConflict, "version_conflict"},
+		{InvalidObjectIDError{message: "Wrong id format"}, "invalid_argument"},
+		{mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}, "duplicate_key"},
+		{mongo.CommandError{Code: 2}, "query"},
+		{io.EOF, "network"},
+		{errors.New("unknown"), "other"},
+	}
+	for _, tt := range tests {
+		if got := errorClass(tt.err); got != tt.want {
+			t.Errorf("errorClass(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Operations of handler calls seen by middlewares
+const (
+	OperationGetAllItems         = "GetAllItems"
+	OperationGetTotal            = "GetTotal"
+	OperationGetAllItemsNoLimit  = "GetAllItemsNoLimit"
+	OperationAddNewItem          = "AddNewItem"
+	OperationRemoveItemByID      = "RemoveItemByID"
+	OperationRemoveItemBy        = "RemoveItemBy"
+	OperationRemoveAllBy         = "RemoveAllBy"
+	OperationFindItemByID        = "FindItemByID"
+	OperationFindBy              = "FindBy"
+	OperationUpdateBy            = "UpdateBy"
+	OperationUpdateByID          = "UpdateByID"
+	OperationUpsertBy            = "UpsertBy"
+	OperationUpdateByIDIfVersion = "UpdateByIDIfVersion"
+	OperationModifyByID          = "ModifyByID"
+	OperationDistinct            = "Distinct"
+	OperationCountBy             = "CountBy"
+	OperationRestore             = "Restore"
+	OperationPurge               = "Purge"
+	OperationRevisions           = "Revisions"
+	OperationRestoreRevision     = "RestoreRevision"
+	OperationExplain             = "Explain"
+	OperationCopyItems           = "CopyItems"
+	OperationListCollections     = "ListCollections"
+	OperationCreateCollection    = "CreateCollection"
+	OperationDropCollection      = "DropCollection"
+	OperationRenameCollection    = "RenameCollection"
+	OperationCollectionStats     = "CollectionStats"
+	OperationPushSchema          = "PushSchema"
+)
+
+// readOperations operations which do not modify documents
+var readOperations = map[string]bool{
+	OperationGetAllItems:        true,
+	OperationGetTotal:           true,
+	OperationGetAllItemsNoLimit: true,
+	OperationFindItemByID:       true,
+	OperationFindBy:             true,
+	OperationDistinct:           true,
+	OperationCountBy:            true,
+	OperationRevisions:          true,
+	OperationExplain:            true,
+	OperationListCollections:    true,
+	OperationCollectionStats:    true,
+}
+
+func isReadOperation(operation string) bool {
+	return readOperations[operation]
+}
+
+// Call describes a handler call passing through middlewares. Only fields
+// relevant to the operation are set: Filter holds filters or selector and
+// Document holds the inserted item or the update. Context is the one given
+// with WithContext, context.Background() otherwise. Tenant is set by views
+// from ForTenant and Target holds the <database>.<collection> written by
+// copies
+type Call struct {
+	Context   context.Context
+	Operation string
+	Database  string
+	Tenant    string
+	DataName  string
+	Target    string
+	ID        interface{}
+	Filter    map[string]interface{}
+	Document  map[string]interface{}
+	Field     string
+	OrderBy   string
+	SortBy    string
+	Limit     int
+	Page      int
+	Version   int
+	OlderThan time.Duration
+}
+
+// Invoker runs a call and returns its result: PagedResults, int, string,
+// []string, map[string]interface{}, []map[string]interface{}, []interface{},
+// []GroupCount, []Revision, ExplainResult, CollectionStats or nil depending
+// on the operation
+type Invoker func(call *Call) (interface{}, error)
+
+// Middleware wraps handler calls. It may modify the call before invoking
+// next, short-circuit by returning a result of the operation type without
+// invoking next, or observe and replace the result and error
+type Middleware func(call *Call, next Invoker) (interface{}, error)
+
+// middlewareEntry a middleware restricted to some operations, all when empty
+type middlewareEntry struct {
+	middleware Middleware
+	operations map[string]bool
+}
+
+// WithMiddleware add a middleware around the given operations, or around
+// every operation when none is given. Middlewares added first run outermost
+func WithMiddleware(middleware Middleware, operations ...string) Option {
+	entry := middlewareEntry{middleware: middleware}
+	if len(operations) > 0 {
+		entry.operations = make(map[string]bool, len(operations))
+		for _, operation := range operations {
+			entry.operations[operation] = true
+		}
+	}
+	return func(m *mongoHandler) {
+		m.middlewares = append(m.middlewares, entry)
+	}
+}
+
+func (entry middlewareEntry) handles(operation string) bool {
+	return entry.operations == nil || entry.operations[operation]
+}
+
+// operation runs a call on a handler bound to the context of the call
+type operation func(m *mongoHandler, call *Call) (interface{}, error)
+
+// intercept run call through middlewares handling its operation then run.
+// Filter and Document are cloned so middlewares never modify caller maps.
+// The context set on the call by middlewares is the one of the operation.
+// Errors caused by time limits reach middlewares as TimeoutError
+func (m *mongoHandler) intercept(call *Call, run operation) (interface{}, error) {
+	call.Context = m.context()
+	call.Database = m.database
+	if m.tenant != nil {
+		call.Tenant = *m.tenant
+	}
+	invoke := func(call *Call) (interface{}, error) {
+		if err := call.Context.Err(); err == context.DeadlineExceeded {
+			return nil, TimeoutError{err: err}
+		}
+		// Checks run last so middlewares see their errors and they apply to
+		// calls changed by middlewares
+		if err := m.checkCall(call); err != nil {
+			return nil, err
+		}
+		handler := m
+		if len(m.middlewares) > 0 {
+			handler = m.view()
+			handler.ctx = call.Context
+		}
+		result, err := run(handler, call)
+		return result, timeoutError(err)
+	}
+	if len(m.middlewares) == 0 {
+		return invoke(call)
+	}
+	if call.Filter != nil {
+		call.Filter = cloneStringMap(call.Filter)
+	}
+	if call.Document != nil {
+		call.Document = cloneStringMap(call.Document)
+	}
+	for index := len(m.middlewares) - 1; index >= 0; index-- {
+		entry := m.middlewares[index]
+		if !entry.handles(call.Operation) {
+			continue
+		}
+		next := invoke
+		invoke = func(call *Call) (interface{}, error) {
+			return entry.middleware(call, next)
+		}
+	}
+	return invoke(call)
+}
+
+// checkCall sanitize and validate a call right before it runs
+func (m *mongoHandler) checkCall(call *Call) error {
+	if err := m.sanitize(call); err != nil {
+		return err
+	}
+	if err := m.scopeTenant(call); err != nil {
+		return err
+	}
+	if err := m.validateDatabase(); err != nil {
+		return err
+	}
+	if err := m.validateSchema(call); err != nil {
+		return err
+	}
+	return m.readPreference.validate()
+}
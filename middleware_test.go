@@ -0,0 +1,83 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	cached := map[string]interface{}{"_id": fixtureFirstMessageID, "content": "cached"}
+	dbhandler := NewMongoHandler(dbHost, dbName, authDb, dbUser, dbPass, dbPort, 0, WithMiddleware(func(call *Call, next Invoker) (interface{}, error) {
+		if call.ID == fixtureFirstMessageID {
+			return cached, nil
+		}
+		return next(call)
+	}, OperationFindItemByID))
+	found, err := dbhandler.FindItemByID(collectionName, fixtureFirstMessageID)
+	if err != nil {
+		t.Fatalf("Short-circuited call must not return error but got %s", err.Error())
+	}
+	if !reflect.DeepEqual(found, cached) {
+		t.Fatalf("Expected %v but got %v", cached, found)
+	}
+}
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	var trace []string
+	tracing := func(name string) Middleware {
+		return func(call *Call, next Invoker) (interface{}, error) {
+			trace = append(trace, name+" before")
+			result, err := next(call)
+			trace = append(trace, name+" after")
+			return result, err
+		}
+	}
+	dbhandler := &mongoHandler{database: dbName}
+	WithMiddleware(tracing("outer"))(dbhandler)
+	WithMiddleware(tracing("reads"), OperationGetTotal)(dbhandler)
+	WithMiddleware(tracing("inner"))(dbhandler)
+	invoke := func(m *mongoHandler, call *Call) (interface{}, error) {
+		trace = append(trace, "invoke")
+		return 0, nil
+	}
+	dbhandler.intercept(&Call{Operation: OperationGetTotal}, invoke)
+	expected := []string{"outer before", "reads before", "inner before", "invoke", "inner after", "reads after", "outer after"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Fatalf("Expected %v but got %v", expected, trace)
+	}
+	trace = nil
+	dbhandler.intercept(&Call{Operation: OperationUpdateBy}, invoke)
+	expected = []string{"outer before", "inner before", "invoke", "inner after", "outer after"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Fatalf("Middleware must only run around its operations, expected %v but got %v", expected, trace)
+	}
+}
+
+func TestMiddlewareModifyInputsAndErrors(t *testing.T) {
+	failure := errors.New("failure")
+	dbhandler := &mongoHandler{database: dbName}
+	WithMiddleware(func(call *Call, next Invoker) (interface{}, error) {
+		call.Filter["tenantId"] = "acme"
+		result, err := next(call)
+		if err == failure {
+			return nil, errors.New("wrapped: " + err.Error())
+		}
+		return result, err
+	})(dbhandler)
+	filters := map[string]interface{}{"actorID": 1}
+	var seen *Call
+	_, err := dbhandler.intercept(&Call{Operation: OperationGetAllItemsNoLimit, DataName: collectionName, Filter: filters}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		seen = call
+		return nil, failure
+	})
+	if err == nil || err.Error() != "wrapped: failure" {
+		t.Fatalf("Middleware must observe and replace errors, got %v", err)
+	}
+	if seen.Filter["tenantId"] != "acme" || seen.Database != dbName {
+		t.Fatalf("Middleware must be able to modify inputs, got %+v", seen)
+	}
+	if len(filters) != 1 {
+		t.Fatalf("Middleware must not modify caller filters, got %v", filters)
+	}
+}
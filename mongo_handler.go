@@ -1,17 +1,27 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"log"
-	"notify-message/helper"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/globalsign/mgo"
-	"github.com/globalsign/mgo/bson"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonoptions"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrNotFound is returned when no item matches an id or a selector
+var ErrNotFound = errors.New("not found")
+
 // InvalidObjectIDError is returned when wrong object id passed
 type InvalidObjectIDError struct {
 	message string
@@ -22,20 +32,46 @@ func (e InvalidObjectIDError) Error() string {
 }
 
 type mongoHandler struct {
-	host       string
-	port       int
-	database   string
-	autdb      string
-	username   string
-	password   string
-	maxIdleTimeMS int
-	connection *mgo.Session
+	host           string
+	port           int
+	database       string
+	autdb          string
+	username       string
+	password       string
+	maxIdleTimeMS  int
+	connection     *mongo.Client
+	collections    map[string]*collectionConfig
+	timestamps     *timestampConfig
+	versionField   string
+	clock          func() time.Time
+	actor          string
+	ctx            context.Context
+	middlewares    []middlewareEntry
+	maxTime        time.Duration
+	socketTimeout  time.Duration
+	maxResults     int
+	maxPageSize    int
+	readPreference ReadPreference
+	writeConcern   *WriteConcern
+	tls            *TLSConfig
+	mechanism      string
+	poolMonitor    *event.PoolMonitor
+	sanitizer      *Sanitizer
+	tenancy        tenancy
+	tenant         *string
+	tenantErr      error
+	parent         *mongoHandler
 }
 
 func (m *mongoHandler) GetConnection() error {
+	// Views share the connection of their root handler, only the root
+	// stores it
+	if m.parent != nil {
+		return m.parent.GetConnection()
+	}
 	if m.connection == nil {
 		var err error
-		m.connection, err = m.createMongoSession()
+		m.connection, err = m.createMongoClient()
 		if err != nil {
 			return err
 		}
@@ -44,83 +80,98 @@ func (m *mongoHandler) GetConnection() error {
 }
 
 func (m *mongoHandler) IsConnecting() bool {
-	return m.connection != nil
+	return m.root().connection != nil
 }
 
 func (m *mongoHandler) CloseConnection() {
+	// Closing a view must not close the connection shared with its root
+	if m.parent != nil {
+		return
+	}
 	if m.connection != nil {
-		m.connection.Close()
+		m.connection.Disconnect(context.Background())
 		m.connection = nil
 	}
 }
 
 // GetAllItems get all items with paging infor
 func (m *mongoHandler) GetAllItems(dataname, orderBy, sortBy string, limit, page int, filters map[string]interface{}) (PagedResults, error) {
+	call := &Call{Operation: OperationGetAllItems, DataName: dataname, OrderBy: orderBy, SortBy: sortBy, Limit: limit, Page: page, Filter: filters}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.getAllItems(call.DataName, call.OrderBy, call.SortBy, call.Limit, call.Page, call.Filter)
+	})
+	pagedResults, _ := result.(PagedResults)
+	return pagedResults, err
+}
+
+func (m *mongoHandler) getAllItems(dataname, orderBy, sortBy string, limit, page int, filters map[string]interface{}) (PagedResults, error) {
+	limit, err := m.pageLimit(dataname, limit, page)
+	if err != nil {
+		return PagedResults{}, err
+	}
 	// Make sure connection open
-	err := m.GetConnection()
+	err = m.GetConnection()
 	if err != nil {
 		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
 		return PagedResults{}, err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	//var cursorFields  []string
-	c := workingDBSession.DB(m.database).C(dataname)
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataname)
+	filters = m.scopeFilter(dataname, filters)
 	// Get total items by filters
-	total, err := c.Find(filters).Count()
+	total, err := m.countItems(ctx, c, filters)
 	if err != nil {
 		log.Printf("[App.db]: Error during couting items: %s\n", err)
 		return PagedResults{}, err
 	}
-	pagingInfor := helper.NewPaginator(total, limit, page)
-	// Create sortby string
-	sortString := "+" + sortBy
-	if strings.ToUpper(orderBy) == "DESC" {
-		sortString = "-" + sortBy
-	}
+	paginator := NewPaginator(total, limit, page)
 	// First we need to skip previous page items
-	skip := (page * limit) - limit
-	//q := minquery.New(workingDBSession.DB(m.database), dataname, filters).Sort(sortString).Limit(skip)
-	q := c.Find(filters).Sort(sortString).Skip(skip)
-	var items []interface{}
-	err = q.Limit(limit).All(&items)
-	// This will move the cursort to the last item need to skip
-	//skipCursor, err := q.All(&items, cursorFields...)
-	// Startting from last skipped item, we get data
-	//_, err = q.Cursor(skipCursor).Limit(limit).All(&items, cursorFields...)
+	findOptions := options.Find().SetSkip(int64(paginator.Offset())).SetLimit(int64(limit))
+	if sortBy != "" {
+		// Create sortby string
+		sortString := "+" + sortBy
+		if strings.ToUpper(orderBy) == "DESC" {
+			sortString = "-" + sortBy
+		}
+		findOptions.SetSort(sortDocument(sortString))
+	}
+	var items []bson.M
+	err = m.findAll(ctx, c, filters, &items, findOptions)
+	if err != nil {
+		log.Printf("[App.db]: Error during get items: %s\n", err)
+		return PagedResults{}, err
+	}
 	// Cover bson items to generic slices items
 	genericItems := make([]map[string]interface{}, len(items))
 	for index, item := range items {
-		doc := item.(bson.M)
-		genericItems[index] = createMapFromBsonM(doc)
-	}
-	return PagedResults{
-		Total:           total,
-		CurrentPage:     page,
-		TotalPage:       pagingInfor.TotalPage,
-		PageSize:        len(genericItems),
-		NextPage:        pagingInfor.NextPage,
-		PreviousPage:    pagingInfor.PreviousPage,
-		HasNextPage:     pagingInfor.HasNextPage,
-		HasPreviousPage: pagingInfor.HasPreviousPage,
-		Items:           genericItems,
-	}, nil
+		genericItems[index] = createMapFromBsonM(item)
+	}
+	return paginator.Results(genericItems), nil
 }
 
 // GetTotal get all items with paging infor
 func (m *mongoHandler) GetTotal(dataname string, filters map[string]interface{}) (int, error) {
+	call := &Call{Operation: OperationGetTotal, DataName: dataname, Filter: filters}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.getTotal(call.DataName, call.Filter)
+	})
+	total, _ := result.(int)
+	return total, err
+}
+
+func (m *mongoHandler) getTotal(dataname string, filters map[string]interface{}) (int, error) {
 	// Make sure connection open
 	err := m.GetConnection()
 	if err != nil {
 		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
 		return 0, err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	//var cursorFields  []string
-	c := workingDBSession.DB(m.database).C(dataname)
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataname)
 	// Get total items by filters
-	total, err := c.Find(filters).Count()
+	total, err := m.countItems(ctx, c, m.scopeFilter(dataname, filters))
 	if err != nil {
 		log.Printf("[App.db]: Error during couting items: %s\n", err)
 		return 0, err
@@ -131,29 +182,55 @@ func (m *mongoHandler) GetTotal(dataname string, filters map[string]interface{})
 
 // GetAllItemsNoLimit get all items no limit
 func (m *mongoHandler) GetAllItemsNoLimit(dataname string, filters map[string]interface{}) ([]map[string]interface{}, error) {
+	call := &Call{Operation: OperationGetAllItemsNoLimit, DataName: dataname, Filter: filters}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.getAllItemsNoLimit(call.DataName, call.Filter)
+	})
+	items, _ := result.([]map[string]interface{})
+	return items, err
+}
+
+func (m *mongoHandler) getAllItemsNoLimit(dataname string, filters map[string]interface{}) ([]map[string]interface{}, error) {
 	err := m.GetConnection()
 	if err != nil {
 		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
 		return nil, err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataname)
-	var items []interface{}
-	err = c.Find(filters).All(&items)
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataname)
+	var items []bson.M
+	findOptions := options.Find()
+	// Read one more document than allowed to detect large results
+	maxResults := m.maxResultsOf(dataname)
+	if maxResults > 0 {
+		findOptions.SetLimit(int64(maxResults + 1))
+	}
+	err = m.findAll(ctx, c, m.scopeFilter(dataname, filters), &items, findOptions)
 	if err != nil {
 		log.Printf("[App.db]: Error during get all items: %s\n", err)
 		return nil, err
 	}
+	if err = checkResultSize(dataname, len(items), maxResults); err != nil {
+		return nil, err
+	}
 	genericItems := make([]map[string]interface{}, len(items))
 	for index, item := range items {
-		doc := item.(bson.M)
-		genericItems[index] = createMapFromBsonM(doc)
+		genericItems[index] = createMapFromBsonM(item)
 	}
 	return genericItems, err
 }
 
 func (m *mongoHandler) AddNewItem(dataName string, item map[string]interface{}) (map[string]interface{}, error) {
+	call := &Call{Operation: OperationAddNewItem, DataName: dataName, Document: item}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.addNewItem(call.DataName, call.Document)
+	})
+	inserted, _ := result.(map[string]interface{})
+	return inserted, err
+}
+
+func (m *mongoHandler) addNewItem(dataName string, item map[string]interface{}) (map[string]interface{}, error) {
 	// Make sure not modify original map
 	willInsertDoc := cloneStringMap(item)
 	// Make sure connection open
@@ -164,44 +241,85 @@ func (m *mongoHandler) AddNewItem(dataName string, item map[string]interface{})
 	}
 	// Create unique id for item
 	if providedID, ok := willInsertDoc["_id"]; !ok || providedID == nil || providedID == "" {
-		willInsertDoc["_id"] = bson.NewObjectId()
+		willInsertDoc["_id"] = primitive.NewObjectID()
 	}
-	if _, ok := willInsertDoc["_id"].(bson.ObjectId); !ok {
-		willInsertDoc["_id"], err = createObjectID(willInsertDoc["_id"])
-		if err != nil {
-			return willInsertDoc, err
+	objectID, err := createObjectID(willInsertDoc["_id"])
+	if err != nil {
+		return willInsertDoc, err
+	}
+	willInsertDoc["_id"] = objectID
+	m.stampNewDocument(dataName, willInsertDoc)
+	if field := m.versionFieldOf(dataName); field != "" {
+		if _, ok := willInsertDoc[field]; !ok {
+			willInsertDoc[field] = 1
 		}
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
-	err = c.Insert(willInsertDoc)
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	_, err = c.InsertOne(ctx, willInsertDoc)
 	if err != nil {
 		return item, err
 	}
+	tracker, _ := m.trackRevisions(ctx, c, dataName, RevisionInsert, nil, 0)
+	tracker.add(objectID)
+	tracker.record()
 	// return hexid
-	returnedID, _ := willInsertDoc["_id"].(bson.ObjectId).MarshalText()
-	willInsertDoc["_id"] = string(returnedID)
-	return willInsertDoc, err
+	willInsertDoc["_id"] = objectID.Hex()
+	return willInsertDoc, nil
 }
 
 func (m *mongoHandler) RemoveItemByID(dataName string, id interface{}) error {
+	call := &Call{Operation: OperationRemoveItemByID, DataName: dataName, ID: id}
+	_, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, m.removeItemByID(call.DataName, call.ID)
+	})
+	return err
+}
+
+func (m *mongoHandler) removeItemByID(dataName string, id interface{}) error {
 	// Make sure connection open
 	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for removing item %s. %s\n", id, err)
+		return err
+	}
 	// Make sure to use correct object id
 	objectID, err := createObjectID(id)
 	if err != nil {
 		log.Printf("[App.db]: Error remove item %s. %s\n", id, err)
 		return err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
-	response := c.RemoveId(objectID)
-	return response
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	willSelector := m.scopeFilter(dataName, bson.M{"_id": objectID})
+	tracker, err := m.trackRevisions(ctx, c, dataName, RevisionRemove, willSelector, 1)
+	if err != nil {
+		return err
+	}
+	if m.configOf(dataName).softDelete {
+		err = m.softRemove(ctx, c, dataName, willSelector)
+	} else {
+		err = deleteOne(ctx, c, willSelector)
+	}
+	if err != nil {
+		return err
+	}
+	tracker.record()
+	return nil
 }
 
 func (m *mongoHandler) FindItemByID(dataName string, id interface{}) (map[string]interface{}, error) {
+	call := &Call{Operation: OperationFindItemByID, DataName: dataName, ID: id}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.findItemByID(call.DataName, call.ID)
+	})
+	item, _ := result.(map[string]interface{})
+	return item, err
+}
+
+func (m *mongoHandler) findItemByID(dataName string, id interface{}) (map[string]interface{}, error) {
 	var data map[string]interface{}
 	// Make sure connection open
 	err := m.GetConnection()
@@ -215,35 +333,44 @@ func (m *mongoHandler) FindItemByID(dataName string, id interface{}) (map[string
 		log.Printf("[App.db]: Error during create object id %s. %s\n", id, err)
 		return data, err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
-	var found interface{}
-	err = c.FindId(objectID).One(&found)
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	var found bson.M
+	err = m.findOne(ctx, c, m.scopeFilter(dataName, bson.M{"_id": objectID}), &found)
 	if err != nil {
 		log.Printf("[App.db]: Error find item %s. %s\n", id, err)
 		return data, err
 	}
-	data = createMapFromBsonM(found.(bson.M))
+	data = createMapFromBsonM(found)
 	return data, nil
 }
 
 func (m *mongoHandler) FindBy(dataName string, selector map[string]interface{}) (map[string]interface{}, error) {
+	call := &Call{Operation: OperationFindBy, DataName: dataName, Filter: selector}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.findBy(call.DataName, call.Filter)
+	})
+	item, _ := result.(map[string]interface{})
+	return item, err
+}
+
+func (m *mongoHandler) findBy(dataName string, selector map[string]interface{}) (map[string]interface{}, error) {
 	var data map[string]interface{}
 	// Make sure connection open
 	err := m.GetConnection()
 	if err != nil {
 		return data, err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
-	var found interface{}
-	err = c.Find(selector).One(&found)
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	var found bson.M
+	err = m.findOne(ctx, c, m.scopeFilter(dataName, selector), &found)
 	if err != nil {
 		return data, err
 	}
-	data = createMapFromBsonM(found.(bson.M))
+	data = createMapFromBsonM(found)
 	return data, nil
 }
 
@@ -253,8 +380,9 @@ func createMapFromBsonM(doc bson.M) map[string]interface{} {
 	message = map[string]interface{}(doc)
 	// Set id to id string
 	if isBsonMContenNonEmptyKey(doc, "_id") {
-		objectIDText, _ := doc["_id"].(bson.ObjectId).MarshalText()
-		message["_id"] = string(objectIDText)
+		if objectID, ok := doc["_id"].(primitive.ObjectID); ok {
+			message["_id"] = objectID.Hex()
+		}
 	}
 	return message
 }
@@ -264,6 +392,18 @@ func isBsonMContenNonEmptyKey(data bson.M, key string) bool {
 }
 
 func (m *mongoHandler) UpdateBy(dataName string, selector, update map[string]interface{}) (int, error) {
+	call := &Call{Operation: OperationUpdateBy, DataName: dataName, Filter: selector, Document: update}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.updateBy(call.DataName, call.Filter, call.Document)
+	})
+	updated, _ := result.(int)
+	return updated, err
+}
+
+func (m *mongoHandler) updateBy(dataName string, selector, update map[string]interface{}) (int, error) {
+	if err := m.checkSelector(dataName, selector); err != nil {
+		return 0, err
+	}
 	// Make sure connection open
 	err := m.GetConnection()
 	if err != nil {
@@ -271,35 +411,111 @@ func (m *mongoHandler) UpdateBy(dataName string, selector, update map[string]int
 		return 0, err
 	}
 	willUpdateDoc := cloneStringMap(update)
-	willSelector := cloneStringMap(selector)
-	delete(update, "_id")
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
-	rs, err := c.UpdateAll(willSelector, bson.M{"$set": willUpdateDoc})
-	return rs.Updated, err
+	willSelector := m.scopeFilter(dataName, selector)
+	delete(willUpdateDoc, "_id")
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	tracker, err := m.trackRevisions(ctx, c, dataName, RevisionUpdate, willSelector, 0)
+	if err != nil {
+		return 0, err
+	}
+	rs, err := c.UpdateMany(ctx, tracker.selector(willSelector), m.updateOperators(dataName, willUpdateDoc, false))
+	if err != nil {
+		return 0, err
+	}
+	tracker.record()
+	return int(rs.ModifiedCount), nil
+}
+
+// UpsertBy update first item matching selector or insert a new one built from
+// selector and update. It returns hex id of the inserted item, empty when an
+// existing item was updated
+func (m *mongoHandler) UpsertBy(dataName string, selector, update map[string]interface{}) (string, error) {
+	call := &Call{Operation: OperationUpsertBy, DataName: dataName, Filter: selector, Document: update}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.upsertBy(call.DataName, call.Filter, call.Document)
+	})
+	upsertedID, _ := result.(string)
+	return upsertedID, err
+}
+
+func (m *mongoHandler) upsertBy(dataName string, selector, update map[string]interface{}) (string, error) {
+	if err := m.checkSelector(dataName, selector); err != nil {
+		return "", err
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for upserting item %s. %s\n", selector, err)
+		return "", err
+	}
+	willUpdateDoc := cloneStringMap(update)
+	willSelector := m.scopeFilter(dataName, selector)
+	delete(willUpdateDoc, "_id")
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	tracker, err := m.trackRevisions(ctx, c, dataName, RevisionUpsert, willSelector, 1)
+	if err != nil {
+		return "", err
+	}
+	rs, err := c.UpdateOne(ctx, willSelector, m.updateOperators(dataName, willUpdateDoc, true), options.Update().SetUpsert(true))
+	if err != nil {
+		return "", err
+	}
+	if upsertedID, ok := rs.UpsertedID.(primitive.ObjectID); ok {
+		tracker.add(upsertedID)
+		tracker.record()
+		return upsertedID.Hex(), nil
+	}
+	tracker.record()
+	return "", nil
 }
 func (m *mongoHandler) UpdateByID(dataName string, id interface{}, update map[string]interface{}) error {
+	call := &Call{Operation: OperationUpdateByID, DataName: dataName, ID: id, Document: update}
+	_, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, m.updateByID(call.DataName, call.ID, call.Document)
+	})
+	return err
+}
+
+func (m *mongoHandler) updateByID(dataName string, id interface{}, update map[string]interface{}) error {
 	// Make sure connection open
 	err := m.GetConnection()
 	if err != nil {
 		log.Printf("[App.db]: Error during get connection for updating item %s. %s\n", id, err)
 		return err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
 	// Make sure to use correct object id
 	objectID, err := createObjectID(id)
 	if err != nil {
 		log.Printf("[App.db]: Error during create object id %s. %s\n", id, err)
 		return err
 	}
+	if m.versionFieldOf(dataName) != "" {
+		return m.replaceLatestVersion(ctx, c, dataName, objectID, update)
+	}
 	// Not allow to update id
 	willUpdateDoc := cloneStringMap(update)
 	delete(willUpdateDoc, "_id")
-	response := c.UpdateId(objectID, willUpdateDoc)
-	return response
+	if err = m.stampReplacement(ctx, c, dataName, objectID, willUpdateDoc); err != nil {
+		return err
+	}
+	willSelector := m.scopeFilter(dataName, bson.M{"_id": objectID})
+	tracker, err := m.trackRevisions(ctx, c, dataName, RevisionUpdate, willSelector, 1)
+	if err != nil {
+		return err
+	}
+	err = replaceOne(ctx, c, willSelector, willUpdateDoc)
+	if err != nil {
+		return err
+	}
+	tracker.record()
+	return nil
 }
 
 // func (m *mongoHandler) UpdateByDeviceAndTokenFirebase(dataName string, userID int, device string, token string) (map[string]interface{}, error) {
@@ -356,69 +572,211 @@ func (m *mongoHandler) UpdateByID(dataName string, id interface{}, update map[st
 // }
 
 func (m *mongoHandler) RemoveItemBy(dataName string, selector map[string]interface{}) error {
+	call := &Call{Operation: OperationRemoveItemBy, DataName: dataName, Filter: selector}
+	_, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, m.removeItemBy(call.DataName, call.Filter)
+	})
+	return err
+}
+
+func (m *mongoHandler) removeItemBy(dataName string, selector map[string]interface{}) error {
+	if err := m.checkSelector(dataName, selector); err != nil {
+		return err
+	}
 	// Make sure connection open
 	err := m.GetConnection()
 	if err != nil {
 		log.Printf("[App.db]: Error during get connection for RemoveItemBy %s\n", err)
 		return err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
-	response := c.Remove(selector)
-	// Make sure to use correct object id
-	return response
-}
-
-func createObjectID(id interface{}) (bson.ObjectId, error) {
-	if _, ok := id.(bson.ObjectId); !ok {
-		// Incase input is string
-		stringID, ok := id.(string)
-		if ok {
-			if !bson.IsObjectIdHex(stringID) {
-				return bson.ObjectId(""), errors.New("Wrong id format")
-			}
-			return bson.ObjectIdHex(stringID), nil
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	willSelector := m.scopeFilter(dataName, selector)
+	tracker, err := m.trackRevisions(ctx, c, dataName, RevisionRemove, willSelector, 1)
+	if err != nil {
+		return err
+	}
+	if m.configOf(dataName).softDelete {
+		err = m.softRemove(ctx, c, dataName, tracker.selector(willSelector))
+	} else {
+		err = deleteOne(ctx, c, tracker.selector(willSelector))
+	}
+	if err != nil {
+		return err
+	}
+	tracker.record()
+	return nil
+}
+
+// RemoveAllBy remove every item matching selector and return how many were
+// removed
+func (m *mongoHandler) RemoveAllBy(dataName string, selector map[string]interface{}) (int, error) {
+	call := &Call{Operation: OperationRemoveAllBy, DataName: dataName, Filter: selector}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.removeAllBy(call.DataName, call.Filter)
+	})
+	removed, _ := result.(int)
+	return removed, err
+}
+
+func (m *mongoHandler) removeAllBy(dataName string, selector map[string]interface{}) (int, error) {
+	if err := m.checkSelector(dataName, selector); err != nil {
+		return 0, err
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for RemoveAllBy %s\n", err)
+		return 0, err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	willSelector := m.scopeFilter(dataName, selector)
+	tracker, err := m.trackRevisions(ctx, c, dataName, RevisionRemove, willSelector, 0)
+	if err != nil {
+		return 0, err
+	}
+	var removed int64
+	if m.configOf(dataName).softDelete {
+		rs, err := c.UpdateMany(ctx, tracker.selector(willSelector), m.updateOperators(dataName, bson.M{softDeleteField: m.now()}, false))
+		if err != nil {
+			return 0, err
 		}
-		bytesID, ok := id.([]byte)
-		if !ok {
-			return bson.ObjectId(""), errors.New("Unsuported input: only support string and []byte")
+		removed = rs.ModifiedCount
+	} else {
+		rs, err := c.DeleteMany(ctx, tracker.selector(willSelector))
+		if err != nil {
+			return 0, err
+		}
+		removed = rs.DeletedCount
+	}
+	tracker.record()
+	return int(removed), nil
+}
+
+func createObjectID(id interface{}) (primitive.ObjectID, error) {
+	switch value := id.(type) {
+	case primitive.ObjectID:
+		return value, nil
+	// Incase input is string
+	case string:
+		objectID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return primitive.NilObjectID, InvalidObjectIDError{message: "Wrong id format"}
 		}
-		// create a (may be invalid) object type of ObjectId
-		var result = bson.ObjectId(bytesID)
-		err := result.UnmarshalText(bytesID)
+		return objectID, nil
+	case []byte:
+		objectID, err := primitive.ObjectIDFromHex(string(value))
 		if err != nil {
-			return bson.ObjectId(""), errors.New("Wrong id format")
+			return primitive.NilObjectID, InvalidObjectIDError{message: "Wrong id format"}
 		}
+		return objectID, nil
+	}
+	return primitive.NilObjectID, InvalidObjectIDError{message: "Unsuported input: only support string and []byte"}
+}
 
-		return result, nil
+// findOne decode the first document matching filter into result
+func (m *mongoHandler) findOne(ctx context.Context, c *mongo.Collection, filter, result interface{}, opts ...*options.FindOneOptions) error {
+	opts = append(opts, options.FindOne().SetMaxTime(m.readMaxTime()))
+	err := c.FindOne(ctx, filter, opts...).Decode(result)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
 	}
-	return id.(bson.ObjectId), nil
+	return err
 }
 
-func (m *mongoHandler) createMongoSession() (*mgo.Session, error) {
-	mongoDBDialInfo := &mgo.DialInfo{
-		Addrs:    []string{m.host + ":" + strconv.Itoa(m.port)},
-		Timeout:  60 * time.Second,
-		Database: m.autdb,
-		Username: m.username,
-		Password: m.password,
-		MaxIdleTimeMS: m.maxIdleTimeMS,
+// findAll decode all documents matching filter into results
+func (m *mongoHandler) findAll(ctx context.Context, c *mongo.Collection, filter, results interface{}, opts ...*options.FindOptions) error {
+	opts = append(opts, options.Find().SetMaxTime(m.readMaxTime()))
+	cursor, err := c.Find(ctx, filter, opts...)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+// updateOne apply update to the first document matching selector
+func updateOne(ctx context.Context, c *mongo.Collection, selector, update interface{}) error {
+	rs, err := c.UpdateOne(ctx, selector, update)
+	if err == nil && rs.MatchedCount == 0 {
+		return ErrNotFound
 	}
-	// Create a session which maintains a pool of socket connections
+	return err
+}
+
+// replaceOne replace the first document matching selector
+func replaceOne(ctx context.Context, c *mongo.Collection, selector, replacement interface{}) error {
+	rs, err := c.ReplaceOne(ctx, selector, replacement)
+	if err == nil && rs.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// deleteOne delete the first document matching selector
+func deleteOne(ctx context.Context, c *mongo.Collection, selector interface{}) error {
+	rs, err := c.DeleteOne(ctx, selector)
+	if err == nil && rs.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// newRegistry decode documents into the types the handler always returned:
+// nested documents as bson.M, arrays as []interface{}, dates as local
+// time.Time and 32 bits integers as int
+func newRegistry() *bsoncodec.Registry {
+	registry := bson.NewRegistry()
+	registry.RegisterTypeMapEntry(bsontype.EmbeddedDocument, reflect.TypeOf(bson.M{}))
+	registry.RegisterTypeMapEntry(bsontype.Array, reflect.TypeOf([]interface{}{}))
+	registry.RegisterTypeMapEntry(bsontype.DateTime, reflect.TypeOf(time.Time{}))
+	registry.RegisterTypeMapEntry(bsontype.Int32, reflect.TypeOf(0))
+	registry.RegisterTypeDecoder(reflect.TypeOf(time.Time{}), bsoncodec.NewTimeCodec(bsonoptions.TimeCodec().SetUseLocalTimeZone(true)))
+	return registry
+}
+
+var registry = newRegistry()
+
+func (m *mongoHandler) createMongoClient() (*mongo.Client, error) {
+	clientOptions := options.Client().
+		SetHosts([]string{m.host + ":" + strconv.Itoa(m.port)}).
+		SetConnectTimeout(60 * time.Second).
+		SetServerSelectionTimeout(60 * time.Second).
+		SetMaxConnIdleTime(time.Duration(m.maxIdleTimeMS) * time.Millisecond).
+		SetRegistry(registry)
+	if m.poolMonitor != nil {
+		clientOptions.SetPoolMonitor(m.poolMonitor)
+	}
+	err := m.secure(clientOptions)
+	if err != nil {
+		log.Printf("[App.db]: Error during configure mongo security: %s\n", err)
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	// Create a client which maintains a pool of socket connections
 	// to our MongoDB.
-	mongoSession, err := mgo.DialWithInfo(mongoDBDialInfo)
+	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
 		return nil, err
 	}
-
-	return mongoSession, nil
+	// Connect does not reach the server, ping so wrong addresses and
+	// credentials are reported right away
+	err = client.Ping(ctx, nil)
+	if err != nil {
+		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+	return client, nil
 }
 
 // NewMongoHandler create a instance of mongo db
-func NewMongoHandler(host, database, authdb, username, password string, port, maxIDLETimeMS int) DatabaseHandler {
-	return &mongoHandler{
+func NewMongoHandler(host, database, authdb, username, password string, port, maxIDLETimeMS int, options ...Option) DatabaseHandler {
+	handler := &mongoHandler{
 		host:          host,
 		port:          port,
 		database:      database,
@@ -427,4 +785,8 @@ func NewMongoHandler(host, database, authdb, username, password string, port, ma
 		password:      password,
 		maxIdleTimeMS: maxIDLETimeMS,
 	}
-}
\ No newline at end of file
+	for _, option := range options {
+		option(handler)
+	}
+	return handler
+}
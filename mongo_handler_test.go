@@ -1,13 +1,13 @@
 package db
 
 import (
-	"log"
+	"context"
 	"reflect"
 	"testing"
 	"time"
 
-	"github.com/globalsign/mgo"
-	"github.com/globalsign/mgo/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
@@ -20,20 +20,10 @@ const (
 	collectionName = "notify-message"
 )
 
-func initDbHandler() (*mongoHandler, error) {
-	dbhandler := &mongoHandler{
-		host:     dbHost,
-		port:     dbPort,
-		database: dbName,
-		autdb:    authDb,
-		username: dbUser,
-		password: dbPass,
-	}
-	err := dbhandler.GetConnection()
-	if err != nil {
-		log.Printf("Fail to init db session: %s", err.Error())
-	}
-	return dbhandler, err
+// initDbHandler get a handler on an isolated database of the test server
+// loaded with the notify-message fixtures
+func initDbHandler(t *testing.T) (*mongoHandler, error) {
+	return newTestHandler(t, collectionName), nil
 }
 
 func TestNewMongoHandlerConnection(t *testing.T) {
@@ -53,12 +43,11 @@ func TestNewMongoHandlerConnection(t *testing.T) {
 	}
 }
 func TestInitMongoConnection(t *testing.T) {
+	server := requireTestServer(t)
 	dbhandler := &mongoHandler{
-		host:     dbHost,
-		port:     dbPort,
-		database: dbName,
-		username: dbUser,
-		password: dbPass,
+		host:     "127.0.0.1",
+		port:     server.port,
+		database: testDatabaseName(t),
 	}
 	defer dbhandler.CloseConnection()
 	err := dbhandler.GetConnection()
@@ -70,10 +59,11 @@ func TestInitMongoConnection(t *testing.T) {
 	}
 }
 func TestInitMongoConnectionFail(t *testing.T) {
+	server := requireTestServer(t)
 	dbhandler := &mongoHandler{
-		host:     dbHost,
-		port:     dbPort,
-		database: dbName,
+		host:     "127.0.0.1",
+		port:     server.port,
+		database: testDatabaseName(t),
 		username: "Wronginf",
 		password: dbPass,
 	}
@@ -85,25 +75,15 @@ func TestInitMongoConnectionFail(t *testing.T) {
 }
 
 func TestInsertItem(t *testing.T) {
-	newMessageID := bson.NewObjectId()
+	newMessageID := primitive.NewObjectID()
 	message := map[string]interface{}{
 		"content":      "This is test message",
 		"_id":          newMessageID,
 		"actorID":      1,
 		"targetUserID": 1,
 	}
-	dbhandler := &mongoHandler{
-		host:     dbHost,
-		port:     dbPort,
-		database: dbName,
-		username: dbUser,
-		password: dbPass,
-	}
-	defer dbhandler.CloseConnection()
-	err := dbhandler.GetConnection()
-	if err != nil {
-		t.Fatalf("Fail to init db session: %s", err.Error())
-	}
+	dbhandler := newTestHandler(t)
+	var err error
 	_, err = dbhandler.AddNewItem(collectionName, message)
 	if err != nil {
 		t.Fatalf("Insert item must not return error")
@@ -111,26 +91,16 @@ func TestInsertItem(t *testing.T) {
 }
 
 func TestInsertItemDisconnect(t *testing.T) {
-	newMessageID := bson.NewObjectId()
+	newMessageID := primitive.NewObjectID()
 	message := map[string]interface{}{
 		"content":      "This is test message",
 		"_id":          newMessageID,
 		"actorID":      1,
 		"targetUserID": 1,
 	}
-	dbhandler := &mongoHandler{
-		host:     dbHost,
-		port:     dbPort,
-		database: dbName,
-		username: dbUser,
-		password: dbPass,
-	}
-	defer dbhandler.CloseConnection()
-	err := dbhandler.GetConnection()
-	if err != nil {
-		t.Fatalf("Fail to init db session: %s", err.Error())
-	}
-	dbhandler.connection.LogoutAll()
+	dbhandler := newTestHandler(t)
+	var err error
+	dbhandler.connection.Disconnect(context.Background())
 	_, err = dbhandler.AddNewItem(collectionName, message)
 	if err == nil {
 		t.Fatalf("Insert item must return error")
@@ -145,18 +115,8 @@ func TestInsertItemDontId(t *testing.T) {
 		"actorID":      1,
 		"targetUserID": 1,
 	}
-	dbhandler := &mongoHandler{
-		host:     dbHost,
-		port:     dbPort,
-		database: dbName,
-		username: dbUser,
-		password: dbPass,
-	}
-	defer dbhandler.CloseConnection()
-	err := dbhandler.GetConnection()
-	if err != nil {
-		t.Fatalf("Fail to init db session: %s", err.Error())
-	}
+	dbhandler := newTestHandler(t)
+	var err error
 	_, err = dbhandler.AddNewItem(collectionName, message)
 	if err != nil {
 		t.Fatalf("Insert item must not return error")
@@ -164,7 +124,7 @@ func TestInsertItemDontId(t *testing.T) {
 }
 
 func TestInsertAndFindById(t *testing.T) {
-	newMessageID := bson.NewObjectId()
+	newMessageID := primitive.NewObjectID()
 	createdAt := time.Now()
 	message := map[string]interface{}{
 		"content":      "This is test message",
@@ -173,20 +133,8 @@ func TestInsertAndFindById(t *testing.T) {
 		"targetUserID": 1,
 		"createdAt":    createdAt,
 	}
-	dbhandler := &mongoHandler{
-		host:     dbHost,
-		port:     dbPort,
-		database: dbName,
-		autdb:    authDb,
-		username: dbUser,
-		password: dbPass,
-	}
-	defer dbhandler.CloseConnection()
-	err := dbhandler.GetConnection()
-	if err != nil {
-		t.Fatalf("Fail to init db session: %s", err.Error())
-	}
-	_, err = dbhandler.AddNewItem(collectionName, message)
+	dbhandler := newTestHandler(t)
+	_, err := dbhandler.AddNewItem(collectionName, message)
 	if err != nil {
 		t.Fatalf("Insert item must not return error")
 	}
@@ -200,8 +148,7 @@ func TestInsertAndFindById(t *testing.T) {
 }
 
 func TestFindAll(t *testing.T) {
-	dbhandler, err := initDbHandler()
-	defer dbhandler.CloseConnection()
+	dbhandler, err := initDbHandler(t)
 	if err != nil {
 		t.Fatalf("Fail when init db")
 	}
@@ -215,8 +162,7 @@ func TestFindAll(t *testing.T) {
 }
 
 func TestGetAllItemsNoLimit(t *testing.T) {
-	dbhandler, err := initDbHandler()
-	defer dbhandler.CloseConnection()
+	dbhandler, err := initDbHandler(t)
 	if err != nil {
 		t.Fatalf("Fail when init db")
 	}
@@ -227,8 +173,7 @@ func TestGetAllItemsNoLimit(t *testing.T) {
 }
 
 func TestGetTotalNotifyMessage(t *testing.T) {
-	dbhandler, err := initDbHandler()
-	defer dbhandler.CloseConnection()
+	dbhandler, err := initDbHandler(t)
 	if err != nil {
 		t.Fatalf("Fail when init db")
 	}
@@ -239,9 +184,8 @@ func TestGetTotalNotifyMessage(t *testing.T) {
 }
 
 func TestRemoveItemByID(t *testing.T) {
-	dbhandler, err := initDbHandler()
-	defer dbhandler.CloseConnection()
-	newMessageID := bson.NewObjectId()
+	dbhandler, err := initDbHandler(t)
+	newMessageID := primitive.NewObjectID()
 	createdAt := time.Now()
 	message := map[string]interface{}{
 		"content":      "This is test message",
@@ -267,41 +211,34 @@ func TestRemoveItemByID(t *testing.T) {
 }
 
 func TestRemoveItemBy(t *testing.T) {
-	dbhandler, err := initDbHandler()
-	defer dbhandler.CloseConnection()
-	newMessageID := bson.NewObjectId()
-	createdAt := time.Now()
-	message := map[string]interface{}{
-		"content":      "This is test message",
-		"_id":          newMessageID,
-		"actorID":      1,
-		"targetUserID": 1,
-		"createdAt":    createdAt,
+	dbhandler := newTestHandler(t, collectionName)
+	filter := map[string]interface{}{
+		"targetUserID": 12,
 	}
-	_, err = dbhandler.AddNewItem(collectionName, message)
+	find, err := dbhandler.FindBy(collectionName, filter)
 	if err != nil {
-		t.Fatalf("Insert item must not return error")
-	}
-
-	filter := map[string]interface{}{
-		"actorID": 1,
+		t.Fatalf("Error during find message by filter: %s", err.Error())
 	}
-	_, err = dbhandler.FindBy(collectionName, filter)
+	err = dbhandler.RemoveItemBy(collectionName, filter)
 	if err != nil {
-		t.Fatalf("Error during find message by ID: %s", err.Error())
+		t.Fatalf("Remove item by filter must not return error but got %s", err.Error())
 	}
-	stringID, _ := newMessageID.MarshalText()
-	dbhandler.RemoveItemBy(dbName, filter)
-	_, err = dbhandler.FindItemByID(dbName, string(stringID))
+	_, err = dbhandler.FindItemByID(collectionName, find["_id"])
 	if err == nil {
 		t.Fatalf("After deleting, find must return error")
 	}
+	total, err := dbhandler.GetTotal(collectionName, map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Error when counting items %s", err.Error())
+	}
+	if total != 2 {
+		t.Fatalf("Remove item by filter must only remove one item, %d items left", total)
+	}
 }
 
 func TestInvalidRemoveItemByID(t *testing.T) {
-	dbhandler, err := initDbHandler()
-	defer dbhandler.CloseConnection()
-	newMessageID := bson.NewObjectId()
+	dbhandler, err := initDbHandler(t)
+	newMessageID := primitive.NewObjectID()
 	createdAt := time.Now()
 	message := map[string]interface{}{
 		"content":      "This is test message",
@@ -321,9 +258,8 @@ func TestInvalidRemoveItemByID(t *testing.T) {
 }
 
 func TestInvalidFindID(t *testing.T) {
-	dbhandler, err := initDbHandler()
-	defer dbhandler.CloseConnection()
-	newMessageID := bson.NewObjectId()
+	dbhandler, err := initDbHandler(t)
+	newMessageID := primitive.NewObjectID()
 	createdAt := time.Now()
 	message := map[string]interface{}{
 		"content":      "This is test message",
@@ -341,13 +277,12 @@ func TestInvalidFindID(t *testing.T) {
 		t.Fatalf("Find id must be return error: %s", err.Error())
 		t.Fatalf("result: %+v", find)
 	}
-	dbhandler.RemoveItemByID(collectionName, string(newMessageID))
+	dbhandler.RemoveItemByID(collectionName, newMessageID.Hex())
 }
 
 func TestUpdateBy(t *testing.T) {
-	dbhandler, err := initDbHandler()
-	defer dbhandler.CloseConnection()
-	newMessageID := bson.NewObjectId()
+	dbhandler, err := initDbHandler(t)
+	newMessageID := primitive.NewObjectID()
 	createdAt := time.Now()
 	message := map[string]interface{}{
 		"content":      "This is test message",
@@ -384,9 +319,8 @@ func TestUpdateBy(t *testing.T) {
 }
 
 func TestUpdateByID(t *testing.T) {
-	dbhandler, err := initDbHandler()
-	defer dbhandler.CloseConnection()
-	newMessageID := bson.NewObjectId()
+	dbhandler, err := initDbHandler(t)
+	newMessageID := primitive.NewObjectID()
 	createdAt := time.Now()
 	message := map[string]interface{}{
 		"content":      "This is test message",
@@ -417,9 +351,8 @@ func TestUpdateByID(t *testing.T) {
 }
 
 func TestUpdateByIDDisconnect(t *testing.T) {
-	dbhandler, err := initDbHandler()
-	defer dbhandler.CloseConnection()
-	newMessageID := bson.NewObjectId()
+	dbhandler, err := initDbHandler(t)
+	newMessageID := primitive.NewObjectID()
 	createdAt := time.Now()
 	message := map[string]interface{}{
 		"content":      "This is test message",
@@ -437,7 +370,7 @@ func TestUpdateByIDDisconnect(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error during find message by ID: %s", err.Error())
 	}
-	dbhandler.connection.LogoutAll()
+	dbhandler.connection.Disconnect(context.Background())
 	err = dbhandler.UpdateByID(collectionName, (insertedItem["_id"].(string)), insertedItem)
 	if err == nil {
 		t.Fatalf("Update by id must return error but got %s", err.Error())
@@ -445,9 +378,8 @@ func TestUpdateByIDDisconnect(t *testing.T) {
 }
 
 func TestInvalidUpdateByID(t *testing.T) {
-	dbhandler, err := initDbHandler()
-	defer dbhandler.CloseConnection()
-	newMessageID := bson.NewObjectId()
+	dbhandler, err := initDbHandler(t)
+	newMessageID := primitive.NewObjectID()
 	createdAt := time.Now()
 	message := map[string]interface{}{
 		"content":      "This is test message",
@@ -505,7 +437,7 @@ func Test_initDbHandler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := initDbHandler()
+			got, err := initDbHandler(t)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("initDbHandler() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -525,7 +457,7 @@ func Test_mongoHandler_AddNewItem(t *testing.T) {
 		autdb      string
 		username   string
 		password   string
-		connection *mgo.Session
+		connection *mongo.Client
 	}
 	type args struct {
 		dataName string
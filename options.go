@@ -0,0 +1,48 @@
+package db
+
+// Option configures optional behaviours of a mongo handler
+type Option func(*mongoHandler)
+
+// collectionConfig holds behaviours enabled for a single collection
+type collectionConfig struct {
+	softDelete   bool
+	noTimestamps bool
+	versioned    bool
+	history      bool
+	noStatements bool
+	unbounded    bool
+	matchAll     bool
+	schema       *Schema
+	schemaErr    error
+	references   []string
+}
+
+// WithSoftDelete enable soft delete mode for the given collections
+func WithSoftDelete(dataNames ...string) Option {
+	return func(m *mongoHandler) {
+		for _, dataName := range dataNames {
+			m.collectionConfig(dataName).softDelete = true
+		}
+	}
+}
+
+// collectionConfig get config of a collection, creating it when missing
+func (m *mongoHandler) collectionConfig(dataName string) *collectionConfig {
+	if m.collections == nil {
+		m.collections = make(map[string]*collectionConfig)
+	}
+	config, ok := m.collections[dataName]
+	if !ok {
+		config = &collectionConfig{}
+		m.collections[dataName] = config
+	}
+	return config
+}
+
+// configOf get config of a collection without modifying the handler
+func (m *mongoHandler) configOf(dataName string) collectionConfig {
+	if config, ok := m.collections[dataName]; ok {
+		return *config
+	}
+	return collectionConfig{}
+}
@@ -0,0 +1,61 @@
+package db
+
+// Paginator paging information of a page of results
+type Paginator struct {
+	Total       int
+	Limit       int
+	CurrentPage int
+	TotalPage   int
+	// NextPage number of the next page, 0 on the last page
+	NextPage int
+	// PreviousPage number of the previous page, 0 on the first page
+	PreviousPage    int
+	HasNextPage     bool
+	HasPreviousPage bool
+}
+
+// NewPaginator compute paging information of page for total items split in
+// pages of limit items. Pages start at 1, limit must be at least 1
+func NewPaginator(total, limit, page int) Paginator {
+	paginator := Paginator{Total: total, Limit: limit, CurrentPage: page}
+	if limit > 0 {
+		paginator.TotalPage = (total + limit - 1) / limit
+	}
+	if page < paginator.TotalPage {
+		paginator.HasNextPage = true
+		paginator.NextPage = page + 1
+	}
+	if page > 1 {
+		paginator.HasPreviousPage = true
+		paginator.PreviousPage = page - 1
+		// Pages past the end lead back to the last one
+		if page > paginator.TotalPage {
+			paginator.PreviousPage = paginator.TotalPage
+			paginator.HasPreviousPage = paginator.TotalPage > 0
+		}
+	}
+	return paginator
+}
+
+// Offset number of items before the current page
+func (p Paginator) Offset() int {
+	if p.CurrentPage < 1 {
+		return 0
+	}
+	return (p.CurrentPage - 1) * p.Limit
+}
+
+// Results build paged results of items of the current page
+func (p Paginator) Results(items []map[string]interface{}) PagedResults {
+	return PagedResults{
+		Total:           p.Total,
+		CurrentPage:     p.CurrentPage,
+		TotalPage:       p.TotalPage,
+		PageSize:        len(items),
+		NextPage:        p.NextPage,
+		PreviousPage:    p.PreviousPage,
+		HasNextPage:     p.HasNextPage,
+		HasPreviousPage: p.HasPreviousPage,
+		Items:           items,
+	}
+}
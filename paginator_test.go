@@ -0,0 +1,53 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewPaginator(t *testing.T) {
+	tests := []struct {
+		total, limit, page int
+		want               Paginator
+	}{
+		{0, 10, 1, Paginator{Total: 0, Limit: 10, CurrentPage: 1}},
+		{10, 10, 1, Paginator{Total: 10, Limit: 10, CurrentPage: 1, TotalPage: 1}},
+		{25, 10, 1, Paginator{Total: 25, Limit: 10, CurrentPage: 1, TotalPage: 3, NextPage: 2, HasNextPage: true}},
+		{25, 10, 2, Paginator{Total: 25, Limit: 10, CurrentPage: 2, TotalPage: 3, NextPage: 3, HasNextPage: true, PreviousPage: 1, HasPreviousPage: true}},
+		{25, 10, 3, Paginator{Total: 25, Limit: 10, CurrentPage: 3, TotalPage: 3, PreviousPage: 2, HasPreviousPage: true}},
+		{25, 10, 7, Paginator{Total: 25, Limit: 10, CurrentPage: 7, TotalPage: 3, PreviousPage: 3, HasPreviousPage: true}},
+		{0, 10, 2, Paginator{Total: 0, Limit: 10, CurrentPage: 2}},
+	}
+	for _, tt := range tests {
+		if got := NewPaginator(tt.total, tt.limit, tt.page); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NewPaginator(%d, %d, %d) = %+v, want %+v", tt.total, tt.limit, tt.page, got, tt.want)
+		}
+	}
+}
+
+func TestPaginatorOffset(t *testing.T) {
+	if offset := NewPaginator(25, 10, 3).Offset(); offset != 20 {
+		t.Fatalf("Expected offset 20 but got %d", offset)
+	}
+	if offset := NewPaginator(25, 10, 1).Offset(); offset != 0 {
+		t.Fatalf("First page must not skip items but got %d", offset)
+	}
+}
+
+func TestPaginatorResults(t *testing.T) {
+	items := []map[string]interface{}{{"_id": "1"}, {"_id": "2"}}
+	expected := PagedResults{
+		Total:           12,
+		CurrentPage:     2,
+		TotalPage:       3,
+		PageSize:        2,
+		NextPage:        3,
+		PreviousPage:    1,
+		HasNextPage:     true,
+		HasPreviousPage: true,
+		Items:           items,
+	}
+	if results := NewPaginator(12, 5, 2).Results(items); !reflect.DeepEqual(results, expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, results)
+	}
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultQueryLimit page size of queries without limit parameter
+const DefaultQueryLimit = 20
+
+// Query string parameters which are not fields
+const (
+	QuerySort  = "sort"
+	QueryPage  = "page"
+	QueryLimit = "limit"
+)
+
+// FieldType type query string values of a field are converted to
+type FieldType int
+
+// Field types
+const (
+	FieldString FieldType = iota
+	FieldInt
+	FieldFloat
+	FieldBool
+	// FieldTime RFC 3339 timestamps or 2006-01-02 dates
+	FieldTime
+	// FieldObjectID hex object ids
+	FieldObjectID
+)
+
+// ErrInvalidQuery is returned when a query string uses a field, operator or
+// value which is not allowed
+var ErrInvalidQuery = errors.New("Wrong query")
+
+// QueryField whitelists a field in query strings
+type QueryField struct {
+	Type FieldType
+	// Filterable allow filtering on the field
+	Filterable bool
+	// Sortable allow sorting by the field
+	Sortable bool
+	// Operators allowed operators among eq, ne, gt, gte, lt, lte, in, nin
+	// and exists. Empty allows all of them
+	Operators []string
+}
+
+// QuerySchema query string rules of a collection. Fields not listed can
+// neither be filtered nor sorted by
+type QuerySchema struct {
+	Fields map[string]QueryField
+	// DefaultSort sort used when the query has none, e.g. "-createdAt"
+	DefaultSort string
+	// DefaultLimit page size used when the query has none, DefaultQueryLimit
+	// when 0
+	DefaultLimit int
+}
+
+// Query arguments of GetAllItems parsed from a query string
+type Query struct {
+	Filter  map[string]interface{}
+	OrderBy string
+	SortBy  string
+	Limit   int
+	Page    int
+}
+
+// queryOperatorNames operators of query strings, e.g. createdAt[gte]=...
+var queryOperatorNames = []string{"eq", "ne", "gt", "gte", "lt", "lte", "in", "nin", "exists"}
+
+// ParseQuery convert query string values such as
+// ?status=unread&createdAt[gte]=2018-09-01&sort=-createdAt&page=2&limit=20
+// to arguments of GetAllItems. Values are converted to the type of their
+// field so they can never carry operators
+func ParseQuery(values url.Values, schema QuerySchema) (Query, error) {
+	query := Query{Page: 1, Limit: schema.DefaultLimit}
+	if query.Limit == 0 {
+		query.Limit = DefaultQueryLimit
+	}
+	var err error
+	if value := values.Get(QueryPage); value != "" {
+		if query.Page, err = strconv.Atoi(value); err != nil || query.Page < 1 {
+			return Query{}, ErrInvalidPage
+		}
+	}
+	if value := values.Get(QueryLimit); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 1 {
+			return Query{}, ErrInvalidLimit
+		}
+	}
+	sortValue := schema.DefaultSort
+	if value := values.Get(QuerySort); value != "" {
+		sortValue = value
+	}
+	if sortValue != "" {
+		if query.SortBy, query.OrderBy, err = schema.parseSort(sortValue); err != nil {
+			return Query{}, err
+		}
+	}
+	// Sorted keys so the same query string always gives the same filter
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var filters []Filter
+	for _, key := range keys {
+		if key == QuerySort || key == QueryPage || key == QueryLimit {
+			continue
+		}
+		filter, err := schema.parseCondition(key, values[key])
+		if err != nil {
+			return Query{}, err
+		}
+		filters = append(filters, filter)
+	}
+	query.Filter = map[string]interface{}{}
+	if len(filters) > 0 {
+		if query.Filter, err = And(filters...).Map(); err != nil {
+			return Query{}, err
+		}
+	}
+	return query, nil
+}
+
+// parseSort parse a sort parameter such as -createdAt
+func (schema QuerySchema) parseSort(value string) (sortBy, orderBy string, err error) {
+	orderBy = "ASC"
+	if strings.HasPrefix(value, "-") {
+		orderBy = "DESC"
+	}
+	sortBy = strings.TrimLeft(value, "+-")
+	if field, ok := schema.Fields[sortBy]; !ok || !field.Sortable {
+		return "", "", fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, sortBy)
+	}
+	return sortBy, orderBy, nil
+}
+
+// parseCondition parse a field[operator]=value parameter
+func (schema QuerySchema) parseCondition(key string, values []string) (Filter, error) {
+	name, operator := key, "eq"
+	if open := strings.Index(key, "["); open > 0 && strings.HasSuffix(key, "]") {
+		name, operator = key[:open], key[open+1:len(key)-1]
+	}
+	field, ok := schema.Fields[name]
+	if !ok || !field.Filterable {
+		return Filter{}, fmt.Errorf("%w: cannot filter by %q", ErrInvalidQuery, name)
+	}
+	if !field.allows(operator) {
+		return Filter{}, fmt.Errorf("%w: operator %q is not allowed on %q", ErrInvalidQuery, operator, name)
+	}
+	switch operator {
+	case "exists":
+		exists, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return Filter{}, fmt.Errorf("%w: %s[exists] must be a boolean", ErrInvalidQuery, name)
+		}
+		return Exists(name, exists), nil
+	case "in", "nin":
+		var items []interface{}
+		for _, value := range values {
+			for _, item := range strings.Split(value, ",") {
+				converted, err := field.convert(name, item)
+				if err != nil {
+					return Filter{}, err
+				}
+				items = append(items, converted)
+			}
+		}
+		return Where(name, "$"+operator, items), nil
+	}
+	if len(values) > 1 {
+		return Filter{}, fmt.Errorf("%w: %q is given more than once", ErrInvalidQuery, key)
+	}
+	converted, err := field.convert(name, values[0])
+	if err != nil {
+		return Filter{}, err
+	}
+	return Where(name, "$"+operator, converted), nil
+}
+
+// allows tell if operator can be used on the field
+func (field QueryField) allows(operator string) bool {
+	operators := field.Operators
+	if len(operators) == 0 {
+		operators = queryOperatorNames
+	}
+	for _, allowed := range operators {
+		if allowed == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// convert coerce a query string value to the type of the field
+func (field QueryField) convert(name, value string) (interface{}, error) {
+	var converted interface{}
+	var err error
+	switch field.Type {
+	case FieldString:
+		converted = value
+	case FieldInt:
+		converted, err = strconv.Atoi(value)
+	case FieldFloat:
+		converted, err = strconv.ParseFloat(value, 64)
+	case FieldBool:
+		converted, err = strconv.ParseBool(value)
+	case FieldTime:
+		converted, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			converted, err = time.Parse("2006-01-02", value)
+		}
+	case FieldObjectID:
+		converted, err = primitive.ObjectIDFromHex(value)
+	default:
+		err = errors.New("unknown field type")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong value %q of %q", ErrInvalidQuery, value, name)
+	}
+	return converted, nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testQuerySchema = QuerySchema{
+	Fields: map[string]QueryField{
+		"category":  {Type: FieldString, Filterable: true, Operators: []string{"eq", "in"}},
+		"seen":      {Type: FieldBool, Filterable: true},
+		"actorID":   {Type: FieldInt, Filterable: true, Sortable: true},
+		"createdAt": {Type: FieldTime, Filterable: true, Sortable: true},
+		"content":   {Type: FieldString, Sortable: true},
+	},
+	DefaultSort: "-createdAt",
+}
+
+func TestParseQuery(t *testing.T) {
+	values, _ := url.ParseQuery("seen=false&createdAt[gte]=2018-09-01&category[in]=comment,like&sort=actorID&page=2&limit=5")
+	query, err := ParseQuery(values, testQuerySchema)
+	if err != nil {
+		t.Fatalf("Query must be valid but got %s", err.Error())
+	}
+	expected := Query{
+		Filter: map[string]interface{}{
+			"$and": []interface{}{
+				map[string]interface{}{"category": map[string]interface{}{"$in": []interface{}{"comment", "like"}}},
+				map[string]interface{}{"createdAt": map[string]interface{}{"$gte": time.Date(2018, 9, 1, 0, 0, 0, 0, time.UTC)}},
+				map[string]interface{}{"seen": map[string]interface{}{"$eq": false}},
+			},
+		},
+		SortBy:  "actorID",
+		OrderBy: "ASC",
+		Limit:   5,
+		Page:    2,
+	}
+	if !reflect.DeepEqual(query, expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, query)
+	}
+}
+
+func TestParseQueryDefaults(t *testing.T) {
+	query, err := ParseQuery(url.Values{}, testQuerySchema)
+	if err != nil {
+		t.Fatalf("Empty query must be valid but got %s", err.Error())
+	}
+	expected := Query{Filter: map[string]interface{}{}, SortBy: "createdAt", OrderBy: "DESC", Limit: DefaultQueryLimit, Page: 1}
+	if !reflect.DeepEqual(query, expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, query)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   error
+	}{
+		{"$where=sleep(1000)", ErrInvalidQuery},
+		{"seen[$function]=1", ErrInvalidQuery},
+		{"category[ne]=like", ErrInvalidQuery},
+		{"content=hello", ErrInvalidQuery},
+		{"actorID=one", ErrInvalidQuery},
+		{"actorID=1&actorID=2", ErrInvalidQuery},
+		{"seen[exists]=maybe", ErrInvalidQuery},
+		{"sort=-seen", ErrInvalidQuery},
+		{"page=0", ErrInvalidPage},
+		{"limit=-1", ErrInvalidLimit},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		if _, err := ParseQuery(values, testQuerySchema); !errors.Is(err, tt.err) {
+			t.Fatalf("Query %s must return %v but got %v", tt.query, tt.err, err)
+		}
+	}
+}
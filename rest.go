@@ -0,0 +1,226 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Routes mounted by NewRESTHandler
+const (
+	RouteList   = "list"
+	RouteGet    = "get"
+	RouteCreate = "create"
+	RoutePatch  = "patch"
+	RouteDelete = "delete"
+)
+
+// DefaultMaxBodyBytes max size of request bodies of REST handlers
+const DefaultMaxBodyBytes = 1 << 20
+
+// ErrUnauthorized can be returned by an Authorizer to answer 401 instead of 403
+var ErrUnauthorized = errors.New("Unauthorized")
+
+// Authorizer decide whether a request may use a route of a collection. An
+// error rejects the request with 403, or 401 when it is ErrUnauthorized
+type Authorizer func(r *http.Request, route string) error
+
+// RESTConfig collection exposed by NewRESTHandler
+type RESTConfig struct {
+	DataName string
+	// Schema fields list requests can filter and sort by
+	Schema QuerySchema
+	// Authorize hooks by route, routes without hook are open
+	Authorize map[string]Authorizer
+	// MaxBodyBytes max size of create and patch bodies, DefaultMaxBodyBytes
+	// when 0
+	MaxBodyBytes int64
+	// Sanitizer applied to create and patch bodies, the zero value rejects
+	// any operator
+	Sanitizer Sanitizer
+}
+
+// itemStore methods of DatabaseHandler used by REST handlers
+type itemStore interface {
+	GetAllItems(dataname, orderBy, sortBy string, limit, page int, filters map[string]interface{}) (PagedResults, error)
+	FindItemByID(dataName string, id interface{}) (map[string]interface{}, error)
+	AddNewItem(dataName string, item map[string]interface{}) (map[string]interface{}, error)
+	UpdateBy(dataName string, selector, update map[string]interface{}) (int, error)
+	RemoveItemByID(dataName string, id interface{}) error
+}
+
+type restHandler struct {
+	handler itemStore
+	config  RESTConfig
+}
+
+// NewRESTHandler serve JSON CRUD routes of a collection:
+//
+//	GET    /      list items, query string parsed with ParseQuery
+//	GET    /{id}  get an item
+//	POST   /      create an item
+//	PATCH  /{id}  change fields of an item
+//	DELETE /{id}  remove an item
+//
+// Mount it under a prefix with http.StripPrefix. Any DatabaseHandler can be
+// given, only the methods serving these routes are used
+func NewRESTHandler(handler itemStore, config RESTConfig) http.Handler {
+	if config.MaxBodyBytes == 0 {
+		config.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	rest := &restHandler{handler: handler, config: config}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", rest.route(RouteList, rest.list))
+	mux.HandleFunc("POST /{$}", rest.route(RouteCreate, rest.create))
+	mux.HandleFunc("GET /{id}", rest.route(RouteGet, rest.get))
+	mux.HandleFunc("PATCH /{id}", rest.route(RoutePatch, rest.patch))
+	mux.HandleFunc("DELETE /{id}", rest.route(RouteDelete, rest.remove))
+	return mux
+}
+
+// route run the authorization hook of route before serve
+func (rest *restHandler) route(route string, serve http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authorize := rest.config.Authorize[route]; authorize != nil {
+			if err := authorize(r, route); err != nil {
+				status := http.StatusForbidden
+				if errors.Is(err, ErrUnauthorized) {
+					status = http.StatusUnauthorized
+				}
+				writeJSONError(w, status, err)
+				return
+			}
+		}
+		serve(w, r)
+	}
+}
+
+func (rest *restHandler) list(w http.ResponseWriter, r *http.Request) {
+	query, err := ParseQuery(r.URL.Query(), rest.config.Schema)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	results, err := rest.handler.GetAllItems(rest.config.DataName, query.OrderBy, query.SortBy, query.Limit, query.Page, query.Filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (rest *restHandler) get(w http.ResponseWriter, r *http.Request) {
+	item, err := rest.handler.FindItemByID(rest.config.DataName, r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+func (rest *restHandler) create(w http.ResponseWriter, r *http.Request) {
+	item, err := rest.decode(w, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	inserted, err := rest.handler.AddNewItem(rest.config.DataName, item)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, inserted)
+}
+
+func (rest *restHandler) patch(w http.ResponseWriter, r *http.Request) {
+	changes, err := rest.decode(w, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	id := r.PathValue("id")
+	delete(changes, "_id")
+	if len(changes) > 0 {
+		// Only given fields are set so concurrent changes of other fields
+		// are kept, and versions are incremented by the server
+		var selected interface{} = id
+		if objectID, err := createObjectID(id); err == nil {
+			selected = objectID
+		}
+		if _, err := rest.handler.UpdateBy(rest.config.DataName, map[string]interface{}{"_id": selected}, changes); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	// Missing items and invalid ids are reported by the read
+	item, err := rest.handler.FindItemByID(rest.config.DataName, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+func (rest *restHandler) remove(w http.ResponseWriter, r *http.Request) {
+	if err := rest.handler.RemoveItemByID(rest.config.DataName, r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// errInvalidBody is returned when a request body is not a JSON object
+var errInvalidBody = errors.New("Wrong body, a JSON object is expected")
+
+// decode read a sanitized JSON object from the request body
+func (rest *restHandler) decode(w http.ResponseWriter, r *http.Request) (map[string]interface{}, error) {
+	var item map[string]interface{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, rest.config.MaxBodyBytes))
+	if err := decoder.Decode(&item); err != nil || item == nil {
+		return nil, errInvalidBody
+	}
+	return rest.config.Sanitizer.Sanitize(item)
+}
+
+// statusOf map handler errors to HTTP status codes
+func statusOf(err error) int {
+	if err == errInvalidBody || errors.Is(err, ErrInvalidQuery) || errors.Is(err, ErrInvalidFilter) {
+		return http.StatusBadRequest
+	}
+	switch errorClass(err) {
+	case "not_found":
+		return http.StatusNotFound
+	case "invalid_argument", "result_too_large":
+		return http.StatusBadRequest
+	case "version_conflict", "duplicate_key":
+		return http.StatusConflict
+	case "timeout":
+		return http.StatusGatewayTimeout
+	case "network":
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError answer with the status of err, hiding details of server errors
+func writeError(w http.ResponseWriter, err error) {
+	status := statusOf(err)
+	if status >= http.StatusInternalServerError {
+		log.Printf("[App.db]: Error during serve request: %s\n", err)
+		err = errors.New(http.StatusText(status))
+	}
+	writeJSONError(w, status, err)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("[App.db]: Error during write response: %s\n", err)
+	}
+}
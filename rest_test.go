@@ -0,0 +1,185 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// memoryStore in memory itemStore used by REST handlers
+type memoryStore struct {
+	items      map[string]map[string]interface{}
+	nextID     int
+	lastQuery  Query
+	lastUpdate map[string]interface{}
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{items: map[string]map[string]interface{}{}}
+}
+
+func (s *memoryStore) GetAllItems(dataname, orderBy, sortBy string, limit, page int, filters map[string]interface{}) (PagedResults, error) {
+	s.lastQuery = Query{Filter: filters, OrderBy: orderBy, SortBy: sortBy, Limit: limit, Page: page}
+	paginator := NewPaginator(len(s.items), limit, page)
+	items := []map[string]interface{}{}
+	for id := paginator.Offset() + 1; id <= s.nextID && len(items) < limit; id++ {
+		if item, ok := s.items[strconv.Itoa(id)]; ok {
+			items = append(items, item)
+		}
+	}
+	return paginator.Results(items), nil
+}
+
+func (s *memoryStore) FindItemByID(dataName string, id interface{}) (map[string]interface{}, error) {
+	item, ok := s.items[id.(string)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneStringMap(item), nil
+}
+
+func (s *memoryStore) AddNewItem(dataName string, item map[string]interface{}) (map[string]interface{}, error) {
+	if item["content"] == "duplicate" {
+		return nil, ErrVersionConflict
+	}
+	s.nextID++
+	inserted := cloneStringMap(item)
+	inserted["_id"] = strconv.Itoa(s.nextID)
+	s.items[inserted["_id"].(string)] = inserted
+	return inserted, nil
+}
+
+func (s *memoryStore) UpdateBy(dataName string, selector, update map[string]interface{}) (int, error) {
+	s.lastUpdate = update
+	item, ok := s.items[selector["_id"].(string)]
+	if !ok {
+		return 0, nil
+	}
+	for field, value := range update {
+		item[field] = value
+	}
+	return 1, nil
+}
+
+func (s *memoryStore) RemoveItemByID(dataName string, id interface{}) error {
+	if _, ok := s.items[id.(string)]; !ok {
+		return ErrNotFound
+	}
+	delete(s.items, id.(string))
+	return nil
+}
+
+func serveREST(t *testing.T, handler http.Handler, method, target, body string) (int, map[string]interface{}) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	var response map[string]interface{}
+	if recorder.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Response of %s %s must be JSON but got %s", method, target, recorder.Body.String())
+		}
+	}
+	return recorder.Code, response
+}
+
+func TestRESTHandlerCRUD(t *testing.T) {
+	store := newMemoryStore()
+	handler := NewRESTHandler(store, RESTConfig{DataName: collectionName, Schema: testQuerySchema})
+	status, created := serveREST(t, handler, http.MethodPost, "/", `{"content": "hello", "seen": false}`)
+	if status != http.StatusCreated || created["_id"] != "1" {
+		t.Fatalf("Create must answer 201 with the item, got %d %v", status, created)
+	}
+	serveREST(t, handler, http.MethodPost, "/", `{"content": "world"}`)
+	status, item := serveREST(t, handler, http.MethodGet, "/1", "")
+	if status != http.StatusOK || item["content"] != "hello" {
+		t.Fatalf("Get must answer 200 with the item, got %d %v", status, item)
+	}
+	status, item = serveREST(t, handler, http.MethodPatch, "/1", `{"seen": true, "_id": "2"}`)
+	if status != http.StatusOK || item["seen"] != true || item["content"] != "hello" || store.items["1"]["seen"] != true {
+		t.Fatalf("Patch must change only given fields, got %d %v", status, item)
+	}
+	if !reflect.DeepEqual(store.lastUpdate, map[string]interface{}{"seen": true}) {
+		t.Fatalf("Patch must only send given fields, got %v", store.lastUpdate)
+	}
+	status, page := serveREST(t, handler, http.MethodGet, "/?seen=true&sort=-actorID&limit=1", "")
+	if status != http.StatusOK || page["total"] != float64(2) || page["totalPage"] != float64(2) || len(page["items"].([]interface{})) != 1 {
+		t.Fatalf("List must answer 200 with paged results, got %d %v", status, page)
+	}
+	if store.lastQuery.SortBy != "actorID" || store.lastQuery.OrderBy != "DESC" || len(store.lastQuery.Filter) == 0 {
+		t.Fatalf("List must pass the parsed query to the handler, got %+v", store.lastQuery)
+	}
+	if status, _ := serveREST(t, handler, http.MethodDelete, "/1", ""); status != http.StatusNoContent {
+		t.Fatalf("Delete must answer 204 but got %d", status)
+	}
+	if status, _ := serveREST(t, handler, http.MethodGet, "/1", ""); status != http.StatusNotFound {
+		t.Fatalf("Removed items must answer 404 but got %d", status)
+	}
+}
+
+func TestRESTHandlerErrors(t *testing.T) {
+	handler := NewRESTHandler(newMemoryStore(), RESTConfig{DataName: collectionName, Schema: testQuerySchema, MaxBodyBytes: 64})
+	tests := []struct {
+		method, target, body string
+		status               int
+	}{
+		{http.MethodGet, "/?$where=1", "", http.StatusBadRequest},
+		{http.MethodGet, "/?page=0", "", http.StatusBadRequest},
+		{http.MethodPost, "/", `[1, 2]`, http.StatusBadRequest},
+		{http.MethodPost, "/", `{"content": "` + strings.Repeat("a", 100) + `"}`, http.StatusBadRequest},
+		{http.MethodPost, "/", `{"content": "duplicate"}`, http.StatusConflict},
+		{http.MethodPost, "/", `{"content": {"$where": "1"}}`, http.StatusBadRequest},
+		{http.MethodPatch, "/42", `{"seen": true}`, http.StatusNotFound},
+		{http.MethodDelete, "/42", "", http.StatusNotFound},
+		{http.MethodPut, "/42", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if status, _ := serveREST(t, handler, tt.method, tt.target, tt.body); status != tt.status {
+			t.Fatalf("%s %s must answer %d but got %d", tt.method, tt.target, tt.status, status)
+		}
+	}
+}
+
+func TestRESTHandlerAuthorize(t *testing.T) {
+	store := newMemoryStore()
+	var routes []string
+	handler := NewRESTHandler(store, RESTConfig{
+		DataName: collectionName,
+		Schema:   testQuerySchema,
+		Authorize: map[string]Authorizer{
+			RouteCreate: func(r *http.Request, route string) error {
+				routes = append(routes, route)
+				if r.Header.Get("Authorization") == "" {
+					return ErrUnauthorized
+				}
+				return nil
+			},
+			RouteDelete: func(r *http.Request, route string) error {
+				return errors.New("Only admins can delete items")
+			},
+		},
+	})
+	if status, _ := serveREST(t, handler, http.MethodPost, "/", `{"content": "hello"}`); status != http.StatusUnauthorized || len(store.items) != 0 {
+		t.Fatalf("Rejected requests must answer 401 without creating items, got %d", status)
+	}
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"content": "hello"}`))
+	request.Header.Set("Authorization", "Bearer token")
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Authorized requests must be served but got %d", recorder.Code)
+	}
+	if status, body := serveREST(t, handler, http.MethodDelete, "/1", ""); status != http.StatusForbidden || body["error"] != "Only admins can delete items" {
+		t.Fatalf("Forbidden requests must answer 403 with the reason, got %d %v", status, body)
+	}
+	if status, _ := serveREST(t, handler, http.MethodGet, "/1", ""); status != http.StatusOK {
+		t.Fatalf("Routes without hook must be open but got %d", status)
+	}
+	if len(routes) != 2 || routes[0] != RouteCreate {
+		t.Fatalf("Hooks must receive their route, got %v", routes)
+	}
+}
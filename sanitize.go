@@ -0,0 +1,142 @@
+package db
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SanitizeMode how operators found in untrusted input are handled
+type SanitizeMode int
+
+// Sanitize modes
+const (
+	// SanitizeReject fail with an InjectionError listing offending paths
+	SanitizeReject SanitizeMode = iota
+	// SanitizeStrip drop offending keys
+	SanitizeStrip
+	// SanitizeEscape keep offending keys as plain field names, replacing
+	// their leading $ by a full width ＄
+	SanitizeEscape
+)
+
+// escapedDollar replacement of the leading $ of escaped keys
+const escapedDollar = "＄"
+
+// dangerousOperators operators running code or expressions on the server,
+// never accepted from untrusted input
+var dangerousOperators = map[string]bool{
+	"$where":       true,
+	"$function":    true,
+	"$accumulator": true,
+	"$expr":        true,
+}
+
+// InjectionError is returned when untrusted input has operators
+type InjectionError struct {
+	// Paths dotted paths of offending keys, e.g. userId.$ne
+	Paths []string
+}
+
+func (e InjectionError) Error() string {
+	return "Operators are not allowed in input: " + strings.Join(e.Paths, ", ")
+}
+
+// Sanitizer detect operators in selectors and documents coming from
+// untrusted input such as JSON bodies. The zero value rejects any operator
+type Sanitizer struct {
+	Mode SanitizeMode
+	// AllowOperators accept query operators such as $ne or $in, only
+	// $where, $function, $accumulator and $expr are handled by Mode
+	AllowOperators bool
+}
+
+// Sanitizing get a view of the handler sanitizing selectors and documents
+// of its calls, for calls passing untrusted input
+func (m *mongoHandler) Sanitizing(sanitizer Sanitizer) DatabaseHandler {
+	view := m.view()
+	view.sanitizer = &sanitizer
+	return view
+}
+
+// Sanitize get a copy of input handled according to the sanitizer mode
+func (s Sanitizer) Sanitize(input map[string]interface{}) (map[string]interface{}, error) {
+	if input == nil {
+		return nil, nil
+	}
+	var paths []string
+	sanitized := s.sanitizeDoc(input, "", &paths)
+	if len(paths) > 0 && s.Mode == SanitizeReject {
+		sort.Strings(paths)
+		return nil, InjectionError{Paths: paths}
+	}
+	return sanitized, nil
+}
+
+// offending tell if key must be handled
+func (s Sanitizer) offending(key string) bool {
+	if !strings.HasPrefix(key, "$") {
+		return false
+	}
+	return !s.AllowOperators || dangerousOperators[key]
+}
+
+func (s Sanitizer) sanitizeDoc(doc map[string]interface{}, path string, paths *[]string) map[string]interface{} {
+	sanitized := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+		if s.offending(key) {
+			*paths = append(*paths, keyPath)
+			switch s.Mode {
+			case SanitizeStrip:
+				continue
+			case SanitizeEscape:
+				key = escapedDollar + strings.TrimPrefix(key, "$")
+			}
+		}
+		sanitized[key] = s.sanitizeValue(value, keyPath, paths)
+	}
+	return sanitized
+}
+
+func (s Sanitizer) sanitizeValue(value interface{}, path string, paths *[]string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return s.sanitizeDoc(v, path, paths)
+	case primitive.M:
+		return s.sanitizeDoc(v, path, paths)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for index, item := range v {
+			values[index] = s.sanitizeValue(item, path+"."+strconv.Itoa(index), paths)
+		}
+		return values
+	case primitive.A:
+		return s.sanitizeValue([]interface{}(v), path, paths)
+	case []map[string]interface{}:
+		values := make([]interface{}, len(v))
+		for index, item := range v {
+			values[index] = s.sanitizeDoc(item, path+"."+strconv.Itoa(index), paths)
+		}
+		return values
+	}
+	return value
+}
+
+// sanitize apply the sanitizer of the view to the call input
+func (m *mongoHandler) sanitize(call *Call) error {
+	if m.sanitizer == nil {
+		return nil
+	}
+	var err error
+	if call.Filter, err = m.sanitizer.Sanitize(call.Filter); err != nil {
+		return err
+	}
+	call.Document, err = m.sanitizer.Sanitize(call.Document)
+	return err
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testInjection() map[string]interface{} {
+	return map[string]interface{}{
+		"userId": map[string]interface{}{"$ne": nil},
+		"$or":    []interface{}{map[string]interface{}{"$where": "sleep(1000)"}, map[string]interface{}{"seen": true}},
+		"seen":   false,
+	}
+}
+
+func TestSanitizeReject(t *testing.T) {
+	_, err := Sanitizer{}.Sanitize(testInjection())
+	injection, ok := err.(InjectionError)
+	if !ok {
+		t.Fatalf("Operators must be rejected with InjectionError but got %v", err)
+	}
+	if expected := []string{"$or", "$or.0.$where", "userId.$ne"}; !reflect.DeepEqual(injection.Paths, expected) {
+		t.Fatalf("Expected offending paths %v but got %v", expected, injection.Paths)
+	}
+	_, err = Sanitizer{AllowOperators: true}.Sanitize(testInjection())
+	if injection, ok := err.(InjectionError); !ok || !reflect.DeepEqual(injection.Paths, []string{"$or.0.$where"}) {
+		t.Fatalf("Only dangerous operators must be rejected when operators are allowed, got %v", err)
+	}
+	if sanitized, err := (Sanitizer{}).Sanitize(map[string]interface{}{"seen": false}); err != nil || sanitized["seen"] != false {
+		t.Fatalf("Input without operators must be kept, got %v and %v", sanitized, err)
+	}
+}
+
+func TestSanitizeStripAndEscape(t *testing.T) {
+	input := testInjection()
+	stripped, err := Sanitizer{Mode: SanitizeStrip}.Sanitize(input)
+	if expected := map[string]interface{}{"userId": map[string]interface{}{}, "seen": false}; err != nil || !reflect.DeepEqual(stripped, expected) {
+		t.Fatalf("Expected %v but got %v and %v", expected, stripped, err)
+	}
+	escaped, _ := Sanitizer{Mode: SanitizeEscape, AllowOperators: true}.Sanitize(input)
+	expected := map[string]interface{}{
+		"userId": map[string]interface{}{"$ne": nil},
+		"$or":    []interface{}{map[string]interface{}{"＄where": "sleep(1000)"}, map[string]interface{}{"seen": true}},
+		"seen":   false,
+	}
+	if !reflect.DeepEqual(escaped, expected) {
+		t.Fatalf("Expected %v but got %v", expected, escaped)
+	}
+	if !reflect.DeepEqual(input, testInjection()) {
+		t.Fatalf("Sanitize must not change its input")
+	}
+}
+
+func TestSanitizingView(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	view := dbhandler.Sanitizing(Sanitizer{}).(*mongoHandler)
+	invoked := false
+	_, err := view.intercept(&Call{Operation: OperationRemoveItemBy, DataName: collectionName, Filter: testInjection()}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		invoked = true
+		return nil, nil
+	})
+	if _, ok := err.(InjectionError); !ok || invoked {
+		t.Fatalf("Sanitizing views must reject operators before running calls, got %v", err)
+	}
+	if errorClass(err) != "invalid_argument" {
+		t.Fatalf("Injections must be classified as invalid_argument but got %s", errorClass(err))
+	}
+	var filter map[string]interface{}
+	dbhandler.intercept(&Call{Operation: OperationFindBy, DataName: collectionName, Filter: testInjection()}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		filter = call.Filter
+		return nil, nil
+	})
+	if !reflect.DeepEqual(filter, testInjection()) {
+		t.Fatalf("Handlers must not sanitize trusted calls, got %v", filter)
+	}
+}
+
+func TestSanitizeAfterMiddlewares(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	var seen error
+	WithMiddleware(func(call *Call, next Invoker) (interface{}, error) {
+		call.Document = testInjection()
+		result, err := next(call)
+		seen = err
+		return result, err
+	})(dbhandler)
+	view := dbhandler.Sanitizing(Sanitizer{}).(*mongoHandler)
+	_, err := view.intercept(&Call{Operation: OperationAddNewItem, DataName: collectionName, Document: map[string]interface{}{"seen": false}}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		t.Fatalf("Documents changed by middlewares must be sanitized")
+		return nil, nil
+	})
+	if _, ok := err.(InjectionError); !ok {
+		t.Fatalf("Expected InjectionError but got %v", err)
+	}
+	if _, ok := seen.(InjectionError); !ok {
+		t.Fatalf("Middlewares must see rejected calls, got %v", seen)
+	}
+}
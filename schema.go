@@ -0,0 +1,559 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BSON types of schemas
+const (
+	TypeObject   = "object"
+	TypeArray    = "array"
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeLong     = "long"
+	TypeDouble   = "double"
+	TypeNumber   = "number"
+	TypeBool     = "bool"
+	TypeDate     = "date"
+	TypeObjectID = "objectId"
+)
+
+// documentValidationFailure server error code of writes rejected by a
+// collection validator
+const documentValidationFailure = 121
+
+// ErrNoSchema is returned when pushing the schema of a collection without
+// schema
+var ErrNoSchema = errors.New("No schema is registered for this collection")
+
+// ErrInvalidSchema is returned by writes to a collection whose schema could
+// not be compiled
+var ErrInvalidSchema = errors.New("Invalid schema")
+
+// Schema subset of MongoDB $jsonSchema describing documents of a collection
+// or the value of a field. Empty keywords are not checked
+type Schema struct {
+	// BSONType one of the Type constants
+	BSONType string
+	// Required fields of objects
+	Required []string
+	// Properties schemas of object fields
+	Properties map[string]*Schema
+	// AdditionalProperties allow fields missing from Properties, true when nil
+	AdditionalProperties *bool
+	// Items schema of array elements
+	Items *Schema
+	// Enum allowed values
+	Enum      []interface{}
+	Minimum   *float64
+	Maximum   *float64
+	MinLength *int
+	MaxLength *int
+	// Pattern regular expression strings must match
+	Pattern string
+
+	pattern  *regexp.Regexp
+	compiled bool
+}
+
+// FieldError a field not matching its schema
+type FieldError struct {
+	// Path dotted path of the field, e.g. actors.0.name, empty for the document
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// SchemaError is returned when a document does not match the schema of its
+// collection
+type SchemaError struct {
+	Errors []FieldError
+}
+
+func (e SchemaError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for index, fieldError := range e.Errors {
+		messages[index] = strings.TrimSpace(fieldError.Path + " " + fieldError.Message)
+	}
+	return "Document does not match schema: " + strings.Join(messages, "; ")
+}
+
+// WithSchema validate documents inserted into or updated in a collection
+// against schema before sending them. Fields managed by the handler, ids,
+// timestamps, versions, soft delete markers and tenants, are not validated.
+// A schema with an invalid pattern is logged and fails every write
+func WithSchema(dataName string, schema Schema) Option {
+	return func(m *mongoHandler) {
+		config := m.collectionConfig(dataName)
+		compiled, err := schema.compile("")
+		if err != nil {
+			log.Printf("[App.db]: Invalid schema of %s: %s\n", dataName, err)
+			config.schema, config.schemaErr = &schema, err
+			return
+		}
+		config.schema, config.schemaErr = compiled, nil
+	}
+}
+
+// compile copy the schema with its patterns compiled
+func (s *Schema) compile(path string) (*Schema, error) {
+	compiled := *s
+	compiled.compiled = true
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: pattern of %q: %s", ErrInvalidSchema, path, err)
+		}
+		compiled.pattern = pattern
+	}
+	if s.Properties != nil {
+		compiled.Properties = make(map[string]*Schema, len(s.Properties))
+		for field, property := range s.Properties {
+			schema, err := property.compile(joinPath(path, field))
+			if err != nil {
+				return nil, err
+			}
+			compiled.Properties[field] = schema
+		}
+	}
+	if s.Items != nil {
+		items, err := s.Items.compile(joinPath(path, "items"))
+		if err != nil {
+			return nil, err
+		}
+		compiled.Items = items
+	}
+	return &compiled, nil
+}
+
+// ready get the schema with its patterns compiled
+func (s *Schema) ready() (*Schema, error) {
+	if s.compiled {
+		return s, nil
+	}
+	return s.compile("")
+}
+
+// JSONSchema get the schema as a $jsonSchema document
+func (s *Schema) JSONSchema() map[string]interface{} {
+	doc := map[string]interface{}{}
+	if s.BSONType != "" {
+		doc["bsonType"] = s.BSONType
+	}
+	if len(s.Required) > 0 {
+		doc["required"] = s.Required
+	}
+	if len(s.Properties) > 0 {
+		properties := make(map[string]interface{}, len(s.Properties))
+		for field, property := range s.Properties {
+			properties[field] = property.JSONSchema()
+		}
+		doc["properties"] = properties
+	}
+	if s.AdditionalProperties != nil {
+		doc["additionalProperties"] = *s.AdditionalProperties
+	}
+	if s.Items != nil {
+		doc["items"] = s.Items.JSONSchema()
+	}
+	if len(s.Enum) > 0 {
+		doc["enum"] = s.Enum
+	}
+	if s.Minimum != nil {
+		doc["minimum"] = *s.Minimum
+	}
+	if s.Maximum != nil {
+		doc["maximum"] = *s.Maximum
+	}
+	if s.MinLength != nil {
+		doc["minLength"] = *s.MinLength
+	}
+	if s.MaxLength != nil {
+		doc["maxLength"] = *s.MaxLength
+	}
+	if s.Pattern != "" {
+		doc["pattern"] = s.Pattern
+	}
+	return doc
+}
+
+// Validate check a whole document against the schema, except its _id
+func (s *Schema) Validate(doc map[string]interface{}) error {
+	schema, err := s.ready()
+	if err != nil {
+		return err
+	}
+	return schema.validate(doc, map[string]bool{"_id": true})
+}
+
+// ValidateFields check fields set by an update against the schema, fields
+// may be dotted paths and required fields are not checked
+func (s *Schema) ValidateFields(fields map[string]interface{}) error {
+	schema, err := s.ready()
+	if err != nil {
+		return err
+	}
+	return schema.validateFields(fields, map[string]bool{"_id": true})
+}
+
+// validate check a compiled schema, skipping top level fields set by the
+// handler
+func (s *Schema) validate(doc map[string]interface{}, skip map[string]bool) error {
+	var errs []FieldError
+	s.validateValue(doc, "", skip, &errs)
+	return schemaError(errs)
+}
+
+func (s *Schema) validateFields(fields map[string]interface{}, skip map[string]bool) error {
+	var errs []FieldError
+	for path, value := range fields {
+		if skip[strings.SplitN(path, ".", 2)[0]] {
+			continue
+		}
+		schema, ok := s.lookup(path)
+		if !ok {
+			errs = append(errs, FieldError{Path: path, Message: "is not allowed"})
+			continue
+		}
+		if schema != nil {
+			schema.validateValue(value, path, nil, &errs)
+		}
+	}
+	return schemaError(errs)
+}
+
+func schemaError(errs []FieldError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Path < errs[j].Path
+	})
+	return SchemaError{Errors: errs}
+}
+
+// lookup find the schema of a dotted path, nil when it is not described and
+// false when it is not allowed
+func (s *Schema) lookup(path string) (*Schema, bool) {
+	schema := s
+	for _, segment := range strings.Split(path, ".") {
+		if schema.Items != nil {
+			if _, err := strconv.Atoi(segment); err == nil {
+				schema = schema.Items
+				continue
+			}
+		}
+		property, ok := schema.Properties[segment]
+		if !ok {
+			return nil, schema.AdditionalProperties == nil || *schema.AdditionalProperties
+		}
+		schema = property
+	}
+	return schema, true
+}
+
+func (s *Schema) validateValue(value interface{}, path string, skip map[string]bool, errs *[]FieldError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if s.BSONType != "" && !matchesType(value, s.BSONType) {
+		fail("must be %s", s.BSONType)
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		fail("must be one of %v", s.Enum)
+	}
+	if number, ok := toFloat(value); ok {
+		if s.Minimum != nil && number < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	}
+	if text, ok := value.(string); ok {
+		length := utf8.RuneCountInString(text)
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("must have at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must have at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(text) {
+			fail("must match %s", s.Pattern)
+		}
+	}
+	if doc, ok := toDocument(value); ok {
+		s.validateDocument(doc, path, skip, errs)
+	}
+	if s.Items != nil {
+		if items, ok := toArray(value); ok {
+			for index, item := range items {
+				s.Items.validateValue(item, joinPath(path, strconv.Itoa(index)), nil, errs)
+			}
+		}
+	}
+}
+
+func (s *Schema) validateDocument(doc map[string]interface{}, path string, skip map[string]bool, errs *[]FieldError) {
+	for _, field := range s.Required {
+		if _, ok := doc[field]; !ok && !skip[field] {
+			*errs = append(*errs, FieldError{Path: joinPath(path, field), Message: "is required"})
+		}
+	}
+	for field, value := range doc {
+		// Fields set by the handler are only checked by the server
+		if skip[field] {
+			continue
+		}
+		property, ok := s.Properties[field]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*errs = append(*errs, FieldError{Path: joinPath(path, field), Message: "is not allowed"})
+			}
+			continue
+		}
+		property.validateValue(value, joinPath(path, field), nil, errs)
+	}
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// matchesType tell if value is encoded as bsonType
+func matchesType(value interface{}, bsonType string) bool {
+	switch bsonType {
+	case TypeString:
+		_, ok := value.(string)
+		return ok
+	case TypeBool:
+		_, ok := value.(bool)
+		return ok
+	case TypeDate:
+		switch value.(type) {
+		case time.Time, primitive.DateTime:
+			return true
+		}
+		return false
+	case TypeObjectID:
+		_, ok := value.(primitive.ObjectID)
+		return ok
+	case TypeObject:
+		_, ok := toDocument(value)
+		return ok
+	case TypeArray:
+		_, ok := toArray(value)
+		return ok
+	case TypeInt, TypeLong, TypeDouble, TypeNumber:
+		return numberType(value) == bsonType || bsonType == TypeNumber && numberType(value) != ""
+	}
+	return false
+}
+
+// numberType get the BSON type numbers are encoded as, empty for other values
+func numberType(value interface{}) string {
+	switch number := value.(type) {
+	case int8, int16, int32, uint8, uint16:
+		return TypeInt
+	case int:
+		// The driver writes ints fitting 32 bits as int
+		if int64(number) >= -1<<31 && int64(number) < 1<<31 {
+			return TypeInt
+		}
+		return TypeLong
+	case int64, uint32:
+		return TypeLong
+	case float32, float64:
+		return TypeDouble
+	}
+	return ""
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	if numberType(value) == "" {
+		return 0, false
+	}
+	return reflect.ValueOf(value).Convert(reflect.TypeOf(float64(0))).Float(), true
+}
+
+func toDocument(value interface{}) (map[string]interface{}, bool) {
+	switch doc := value.(type) {
+	case map[string]interface{}:
+		return doc, true
+	case primitive.M:
+		return doc, true
+	}
+	return nil, false
+}
+
+func toArray(value interface{}) ([]interface{}, bool) {
+	if items, ok := value.([]interface{}); ok {
+		return items, true
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	items := make([]interface{}, v.Len())
+	for index := range items {
+		items[index] = v.Index(index).Interface()
+	}
+	return items, true
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	number, isNumber := toFloat(value)
+	for _, allowed := range enum {
+		if allowedNumber, ok := toFloat(allowed); ok && isNumber && allowedNumber == number {
+			return true
+		}
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// managedFields get top level fields of a collection set by the handler
+// rather than by callers
+func (m *mongoHandler) managedFields(dataName string) map[string]bool {
+	fields := map[string]bool{"_id": true}
+	if timestamps := m.timestampsOf(dataName); timestamps != nil {
+		fields[timestamps.createdField] = true
+		fields[timestamps.updatedField] = true
+	}
+	if field := m.versionFieldOf(dataName); field != "" {
+		fields[field] = true
+	}
+	if m.configOf(dataName).softDelete {
+		fields[softDeleteField] = true
+	}
+	// Any view may become a tenant view, so the field is always managed
+	// unless tenants have their own database
+	if !m.tenancy.perDatabase {
+		if m.tenancy.field == "" {
+			fields[DefaultTenantField] = true
+		} else {
+			fields[m.tenancy.field] = true
+		}
+	}
+	return fields
+}
+
+// validateItem check a whole item against the schema of its collection
+func (m *mongoHandler) validateItem(dataName string, item map[string]interface{}) error {
+	config := m.configOf(dataName)
+	if config.schemaErr != nil {
+		return config.schemaErr
+	}
+	if config.schema == nil {
+		return nil
+	}
+	return config.schema.validate(item, m.managedFields(dataName))
+}
+
+// validateSchema check the document of a call against the schema of its
+// collection
+func (m *mongoHandler) validateSchema(call *Call) error {
+	config := m.configOf(call.DataName)
+	if config.schema == nil || call.Document == nil {
+		return nil
+	}
+	switch call.Operation {
+	case OperationAddNewItem, OperationUpdateByID, OperationUpdateByIDIfVersion:
+		return m.validateItem(call.DataName, call.Document)
+	case OperationUpdateBy, OperationUpsertBy:
+		if config.schemaErr != nil {
+			return config.schemaErr
+		}
+		return config.schema.validateFields(call.Document, m.managedFields(call.DataName))
+	}
+	return nil
+}
+
+// jsonSchema get the $jsonSchema validator of a collection. Closed schemas
+// allow the fields set by the handler, which clients do not validate
+func (m *mongoHandler) jsonSchema(dataName string, schema *Schema) map[string]interface{} {
+	doc := schema.JSONSchema()
+	if schema.AdditionalProperties == nil || *schema.AdditionalProperties {
+		return doc
+	}
+	properties, ok := doc["properties"].(map[string]interface{})
+	if !ok {
+		properties = map[string]interface{}{}
+		doc["properties"] = properties
+	}
+	for field := range m.managedFields(dataName) {
+		if _, ok := properties[field]; !ok {
+			properties[field] = map[string]interface{}{}
+		}
+	}
+	return doc
+}
+
+// PushSchema set the schema of a collection as its $jsonSchema validator on
+// the server, creating the collection when missing. Empty level and action
+// keep the server defaults, ValidationStrict and ValidationError
+func (m *mongoHandler) PushSchema(dataName, level, action string) error {
+	call := &Call{Operation: OperationPushSchema, DataName: dataName}
+	_, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, m.pushSchema(call.DataName, level, action)
+	})
+	return err
+}
+
+func (m *mongoHandler) pushSchema(dataName, level, action string) error {
+	config := m.configOf(dataName)
+	if config.schema == nil {
+		return ErrNoSchema
+	}
+	if config.schemaErr != nil {
+		return config.schemaErr
+	}
+	if err := m.manageable(dataName); err != nil {
+		return err
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for pushing schema of %s. %s\n", dataName, err)
+		return err
+	}
+	validator := map[string]interface{}{"$jsonSchema": m.jsonSchema(dataName, config.schema)}
+	collMod := bson.D{
+		{Key: "collMod", Value: dataName},
+		{Key: "validator", Value: validator},
+	}
+	if level != "" {
+		collMod = append(collMod, bson.E{Key: "validationLevel", Value: level})
+	}
+	if action != "" {
+		collMod = append(collMod, bson.E{Key: "validationAction", Value: action})
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	err = m.root().connection.Database(m.database).RunCommand(ctx, collMod).Err()
+	if commandErr, ok := err.(mongo.CommandError); ok && commandErr.HasErrorCode(namespaceNotFound) {
+		return m.createCollection(dataName, CollectionOptions{Validator: validator, ValidationLevel: level, ValidationAction: action})
+	}
+	if err != nil {
+		log.Printf("[App.db]: Error during push schema of %s. %s\n", dataName, err)
+	}
+	return err
+}
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func testSchema() Schema {
+	closed := false
+	maxLength := 5
+	return Schema{
+		BSONType: TypeObject,
+		Required: []string{"actorID", "category"},
+		Properties: map[string]*Schema{
+			"actorID":   {BSONType: TypeInt, Minimum: float(1)},
+			"category":  {BSONType: TypeString, Enum: []interface{}{"comment", "like"}},
+			"seen":      {BSONType: TypeBool},
+			"createdAt": {BSONType: TypeDate},
+			"tags":      {BSONType: TypeArray, Items: &Schema{BSONType: TypeString, MaxLength: &maxLength}},
+			"target": {
+				BSONType:             TypeObject,
+				Required:             []string{"userID"},
+				Properties:           map[string]*Schema{"userID": {BSONType: TypeNumber}},
+				AdditionalProperties: &closed,
+			},
+		},
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := testSchema()
+	valid := map[string]interface{}{
+		"_id":       "5b8f5bd2a7e3b5a0c4a1f001",
+		"actorID":   1,
+		"category":  "like",
+		"createdAt": time.Now(),
+		"tags":      []string{"news"},
+		"target":    map[string]interface{}{"userID": 12.0},
+		"content":   "Extra fields are allowed",
+	}
+	if err := schema.Validate(valid); err != nil {
+		t.Fatalf("Document must be valid but got %s", err.Error())
+	}
+	err := schema.Validate(map[string]interface{}{
+		"actorID":  int64(0),
+		"category": "share",
+		"seen":     "yes",
+		"tags":     []interface{}{"news", "breaking"},
+		"target":   map[string]interface{}{"name": "John"},
+	})
+	schemaErr, ok := err.(SchemaError)
+	if !ok {
+		t.Fatalf("Invalid document must return SchemaError but got %v", err)
+	}
+	expected := []FieldError{
+		{Path: "actorID", Message: "must be int"},
+		{Path: "category", Message: "must be one of [comment like]"},
+		{Path: "seen", Message: "must be bool"},
+		{Path: "tags.1", Message: "must have at most 5 characters"},
+		{Path: "target.name", Message: "is not allowed"},
+		{Path: "target.userID", Message: "is required"},
+	}
+	if !reflect.DeepEqual(schemaErr.Errors, expected) {
+		t.Fatalf("Expected errors %v but got %v", expected, schemaErr.Errors)
+	}
+	if err = schema.Validate(map[string]interface{}{"category": "like", "actorID": 0}); err == nil || err.Error() != "Document does not match schema: actorID must be at least 1" {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
+
+func TestSchemaValidateFields(t *testing.T) {
+	schema := testSchema()
+	if err := schema.ValidateFields(map[string]interface{}{"seen": true, "target.userID": 3, "tags.0": "news", "_id": "1"}); err != nil {
+		t.Fatalf("Updates must only check given fields but got %s", err.Error())
+	}
+	err := schema.ValidateFields(map[string]interface{}{"target.name": "John", "tags.0": 1})
+	if schemaErr, ok := err.(SchemaError); !ok || len(schemaErr.Errors) != 2 || schemaErr.Errors[0].Path != "tags.0" || schemaErr.Errors[1].Path != "target.name" {
+		t.Fatalf("Updated fields must be checked with their path, got %v", err)
+	}
+}
+
+func TestSchemaJSONSchema(t *testing.T) {
+	schema := testSchema()
+	jsonSchema := schema.JSONSchema()
+	if jsonSchema["bsonType"] != TypeObject || !reflect.DeepEqual(jsonSchema["required"], []string{"actorID", "category"}) {
+		t.Fatalf("Unexpected $jsonSchema %v", jsonSchema)
+	}
+	target := jsonSchema["properties"].(map[string]interface{})["target"].(map[string]interface{})
+	if target["additionalProperties"] != false || target["properties"].(map[string]interface{})["userID"].(map[string]interface{})["bsonType"] != TypeNumber {
+		t.Fatalf("Nested schemas must be converted, got %v", target)
+	}
+	actorID := jsonSchema["properties"].(map[string]interface{})["actorID"].(map[string]interface{})
+	if actorID["minimum"] != 1.0 {
+		t.Fatalf("Keywords must be converted, got %v", actorID)
+	}
+}
+
+func TestSchemaHandler(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	WithSchema(collectionName, testSchema())(dbhandler)
+	_, err := dbhandler.AddNewItem(collectionName, map[string]interface{}{"category": "like"})
+	if schemaErr, ok := err.(SchemaError); !ok || schemaErr.Errors[0].Path != "actorID" {
+		t.Fatalf("Inserting an invalid item must return SchemaError but got %v", err)
+	}
+	if errorClass(err) != "invalid_argument" {
+		t.Fatalf("Schema errors must be classified as invalid_argument but got %s", errorClass(err))
+	}
+	if err = dbhandler.UpdateByID(collectionName, fixtureFirstMessageID, map[string]interface{}{"seen": true}); err == nil {
+		t.Fatalf("Replacing with an invalid item must return error")
+	}
+	if _, err = dbhandler.UpdateBy(collectionName, map[string]interface{}{"seen": false}, map[string]interface{}{"actorID": "one"}); err == nil {
+		t.Fatalf("Updating with invalid fields must return error")
+	}
+	if err = dbhandler.PushSchema("other", "", ""); err != ErrNoSchema {
+		t.Fatalf("Pushing without schema must return ErrNoSchema but got %v", err)
+	}
+}
+
+func TestPushSchema(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	WithSchema("reports", testSchema())(dbhandler)
+	if err := dbhandler.PushSchema("reports", ValidationStrict, ValidationError); err != nil {
+		t.Fatalf("Push must create missing collections, got %v", err)
+	}
+	WithSchema(collectionName, Schema{Required: []string{"priority"}})(dbhandler)
+	if err := dbhandler.PushSchema(collectionName, ValidationModerate, ValidationError); err != nil {
+		t.Fatalf("Push must not return error but got %s", err.Error())
+	}
+	// Only the server validates from now on
+	dbhandler.collections = nil
+	_, err := dbhandler.AddNewItem(collectionName, map[string]interface{}{"content": "hello"})
+	if err == nil || errorClass(err) != "invalid_argument" {
+		t.Fatalf("Server must reject invalid items as invalid_argument, got %v", err)
+	}
+	if err = dbhandler.UpdateByID(collectionName, fixtureFirstMessageID, map[string]interface{}{"content": "changed"}); err != nil {
+		t.Fatalf("Moderate validation must accept updates of existing invalid items, got %v", err)
+	}
+}
+
+func closedSchema() Schema {
+	closed := false
+	return Schema{
+		BSONType:             TypeObject,
+		Required:             []string{"content"},
+		Properties:           map[string]*Schema{"content": {BSONType: TypeString}},
+		AdditionalProperties: &closed,
+	}
+}
+
+func TestSchemaManagedFields(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	WithTimestamps("", "")(dbhandler)
+	WithVersioning(collectionName)(dbhandler)
+	WithSoftDelete(collectionName)(dbhandler)
+	WithSchema(collectionName, closedSchema())(dbhandler)
+	item := map[string]interface{}{
+		"_id":                 fixtureFirstMessageID,
+		"content":             "hello",
+		DefaultCreatedAtField: time.Now(),
+		DefaultUpdatedAtField: time.Now(),
+		DefaultVersionField:   3,
+		softDeleteField:       nil,
+		DefaultTenantField:    "acme",
+	}
+	if err := dbhandler.validateItem(collectionName, item); err != nil {
+		t.Fatalf("Fields set by the handler must not be validated, got %s", err.Error())
+	}
+	if err := dbhandler.validateItem(collectionName, map[string]interface{}{"content": "hello", "seen": true}); err == nil {
+		t.Fatalf("Closed schemas must reject unknown fields")
+	}
+	if err := dbhandler.ForTenant("acme").(*mongoHandler).validateSchema(&Call{Operation: OperationUpdateBy, DataName: collectionName, Document: map[string]interface{}{DefaultTenantField: "acme", DefaultVersionField: 4}}); err != nil {
+		t.Fatalf("Updated fields set by the handler must not be validated, got %s", err.Error())
+	}
+	properties := dbhandler.jsonSchema(collectionName, dbhandler.configOf(collectionName).schema)["properties"].(map[string]interface{})
+	for field := range item {
+		if _, ok := properties[field]; !ok {
+			t.Fatalf("Closed $jsonSchema must allow %s, got %v", field, properties)
+		}
+	}
+	if properties := dbhandler.jsonSchema("other", &Schema{}); properties["properties"] != nil {
+		t.Fatalf("Open schemas must be exported as given, got %v", properties)
+	}
+}
+
+func TestSchemaInvalidPattern(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	WithSchema(collectionName, Schema{Properties: map[string]*Schema{"content": {Pattern: "("}}})(dbhandler)
+	if _, err := dbhandler.AddNewItem(collectionName, map[string]interface{}{"content": "hello"}); !errors.Is(err, ErrInvalidSchema) {
+		t.Fatalf("Writes with an invalid schema must return ErrInvalidSchema but got %v", err)
+	}
+	if err := dbhandler.PushSchema(collectionName, "", ""); !errors.Is(err, ErrInvalidSchema) {
+		t.Fatalf("Invalid schemas must not be pushed, got %v", err)
+	}
+	pattern := Schema{Properties: map[string]*Schema{"content": {Pattern: "^[a-z]+$"}}}
+	if err := pattern.Validate(map[string]interface{}{"content": "Hello"}); err == nil || err.Error() != "Document does not match schema: content must match ^[a-z]+$" {
+		t.Fatalf("Patterns must be checked, got %v", err)
+	}
+}
+
+func TestPushClosedSchema(t *testing.T) {
+	dbhandler := newTestHandler(t)
+	WithTimestamps("", "")(dbhandler)
+	WithVersioning("reports")(dbhandler)
+	WithSchema("reports", closedSchema())(dbhandler)
+	if err := dbhandler.PushSchema("reports", ValidationStrict, ValidationError); err != nil {
+		t.Fatalf("Push must not return error but got %s", err.Error())
+	}
+	id, err := dbhandler.AddNewItem("reports", map[string]interface{}{"content": "hello"})
+	if err != nil {
+		t.Fatalf("Server must accept fields set by the handler, got %s", err.Error())
+	}
+	err = dbhandler.ModifyByID("reports", id, func(item map[string]interface{}) error {
+		item["content"] = "changed"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Modifying items of closed schemas must not return error but got %s", err.Error())
+	}
+	if _, err = dbhandler.AddNewItem("reports", map[string]interface{}{"content": "hello", "seen": true}); err == nil {
+		t.Fatalf("Closed schemas must reject unknown fields")
+	}
+}
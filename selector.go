@@ -0,0 +1,57 @@
+package db
+
+import "errors"
+
+// ErrMatchAll is returned when a mutation selector matches every item, which
+// usually means a filter field was left unset
+var ErrMatchAll = errors.New("Selector matches every item, use AllowMatchAll to update or remove all items")
+
+// AllowMatchAll let UpdateBy, UpsertBy, RemoveItemBy and RemoveAllBy run
+// with empty or match-all selectors on the given collections
+func AllowMatchAll(dataNames ...string) Option {
+	return func(m *mongoHandler) {
+		for _, dataName := range dataNames {
+			m.collectionConfig(dataName).matchAll = true
+		}
+	}
+}
+
+// checkSelector refuse match-all selectors of mutations unless allowed
+func (m *mongoHandler) checkSelector(dataName string, selector map[string]interface{}) error {
+	if matchesAll(selector) && !m.configOf(dataName).matchAll {
+		return ErrMatchAll
+	}
+	return nil
+}
+
+// matchesAll tell if selector obviously matches every item: it is empty or
+// only made of $and clauses matching all or $or with a clause matching all
+func matchesAll(selector map[string]interface{}) bool {
+	for key, value := range selector {
+		clauses, ok := toArray(value)
+		switch {
+		case key == "$and" && ok:
+			for _, clause := range clauses {
+				if doc, ok := toDocument(clause); !ok || !matchesAll(doc) {
+					return false
+				}
+			}
+		case key == "$or" && ok:
+			if !anyMatchesAll(clauses) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func anyMatchesAll(clauses []interface{}) bool {
+	for _, clause := range clauses {
+		if doc, ok := toDocument(clause); ok && matchesAll(doc) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMatchesAll(t *testing.T) {
+	tests := []struct {
+		selector map[string]interface{}
+		expected bool
+	}{
+		{nil, true},
+		{map[string]interface{}{}, true},
+		{map[string]interface{}{"$and": []interface{}{map[string]interface{}{}}}, true},
+		{map[string]interface{}{"$or": []interface{}{map[string]interface{}{"seen": true}, map[string]interface{}{}}}, true},
+		{map[string]interface{}{"seen": true}, false},
+		{map[string]interface{}{"$and": []interface{}{map[string]interface{}{}, map[string]interface{}{"seen": true}}}, false},
+		{map[string]interface{}{"$or": []interface{}{map[string]interface{}{"seen": true}}}, false},
+		{map[string]interface{}{"$and": bson.A{bson.M{"x": 1}}}, false},
+		{map[string]interface{}{"$and": []interface{}{bson.M{}}}, true},
+		{map[string]interface{}{"$and": bson.A{bson.M{}}}, true},
+		{map[string]interface{}{"$or": []map[string]interface{}{{"seen": true}, {}}}, true},
+		{map[string]interface{}{"$or": []map[string]interface{}{{"seen": true}}}, false},
+		{map[string]interface{}{"$and": "unknown"}, false},
+	}
+	for _, tt := range tests {
+		if matchesAll(tt.selector) != tt.expected {
+			t.Fatalf("Selector %v must match all %v", tt.selector, tt.expected)
+		}
+	}
+}
+
+func TestMatchAllRefused(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	if _, err := dbhandler.UpdateBy(collectionName, map[string]interface{}{}, map[string]interface{}{"seen": true}); err != ErrMatchAll {
+		t.Fatalf("UpdateBy with empty selector must return ErrMatchAll but got %v", err)
+	}
+	if _, err := dbhandler.UpsertBy(collectionName, nil, map[string]interface{}{"seen": true}); err != ErrMatchAll {
+		t.Fatalf("UpsertBy with empty selector must return ErrMatchAll but got %v", err)
+	}
+	if err := dbhandler.RemoveItemBy(collectionName, map[string]interface{}{}); err != ErrMatchAll {
+		t.Fatalf("RemoveItemBy with empty selector must return ErrMatchAll but got %v", err)
+	}
+	if _, err := dbhandler.RemoveAllBy(collectionName, nil); err != ErrMatchAll {
+		t.Fatalf("RemoveAllBy with empty selector must return ErrMatchAll but got %v", err)
+	}
+	if errorClass(ErrMatchAll) != "invalid_argument" {
+		t.Fatalf("ErrMatchAll must be classified as invalid_argument but got %s", errorClass(ErrMatchAll))
+	}
+	AllowMatchAll(collectionName)(dbhandler)
+	if err := dbhandler.checkSelector(collectionName, nil); err != nil {
+		t.Fatalf("Collections allowing match all must accept empty selectors, got %s", err.Error())
+	}
+	if err := dbhandler.checkSelector("other", nil); err != ErrMatchAll {
+		t.Fatalf("AllowMatchAll must only apply to given collections, got %v", err)
+	}
+}
+
+func TestRemoveAllBy(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	removed, err := dbhandler.RemoveAllBy(collectionName, map[string]interface{}{"category": "comment"})
+	if err != nil {
+		t.Fatalf("RemoveAllBy must not return error but got %s", err.Error())
+	}
+	if removed != 2 {
+		t.Fatalf("RemoveAllBy must remove 2 items but removed %d", removed)
+	}
+	if total, _ := dbhandler.GetTotal(collectionName, map[string]interface{}{}); total != 1 {
+		t.Fatalf("Only 1 item must be left but got %d", total)
+	}
+	AllowMatchAll(collectionName)(dbhandler)
+	if removed, err = dbhandler.RemoveAllBy(collectionName, map[string]interface{}{}); err != nil || removed != 1 {
+		t.Fatalf("RemoveAllBy must remove every item when allowed, got %d and %v", removed, err)
+	}
+}
+
+func TestSoftDeleteRemoveAllBy(t *testing.T) {
+	dbhandler := newSoftDeleteTestHandler(t)
+	removed, err := dbhandler.RemoveAllBy(collectionName, map[string]interface{}{"targetUserID": 1})
+	if err != nil || removed != 2 {
+		t.Fatalf("RemoveAllBy must soft delete 2 items, got %d and %v", removed, err)
+	}
+	if total, _ := dbhandler.GetTotal(collectionName, map[string]interface{}{}); total != 1 {
+		t.Fatalf("Soft deleted items must not be counted, got total %d", total)
+	}
+	if removed, _ = dbhandler.RemoveAllBy(collectionName, map[string]interface{}{"targetUserID": 1}); removed != 0 {
+		t.Fatalf("Soft deleted items must not be removed again, got %d", removed)
+	}
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// softDeleteField marks a document as deleted in soft delete mode
+const softDeleteField = "deletedAt"
+
+// ErrSoftDeleteDisabled is returned when restoring items of a collection without soft delete mode
+var ErrSoftDeleteDisabled = errors.New("Soft delete is not enabled for this collection")
+
+// scopeFilter clone filters and exclude soft deleted documents when the
+// collection uses soft delete mode. Filters explicitly on the marker field
+// are kept untouched so callers can still look into the trash. Tenant views
+// only match items of their tenant and references of the collection are
+// converted to ObjectIds
+func (m *mongoHandler) scopeFilter(dataName string, filters map[string]interface{}) map[string]interface{} {
+	var scoped map[string]interface{}
+	if references := m.referencesOf(dataName); references != nil {
+		scoped = convertReferences(filters, references, "")
+	} else {
+		scoped = cloneStringMap(filters)
+	}
+	if m.configOf(dataName).softDelete {
+		if _, ok := scoped[softDeleteField]; !ok {
+			scoped[softDeleteField] = nil
+		}
+	}
+	return m.tenantFilter(scoped)
+}
+
+// softRemove mark one document matching selector as deleted
+func (m *mongoHandler) softRemove(ctx context.Context, c *mongo.Collection, dataName string, selector map[string]interface{}) error {
+	return updateOne(ctx, c, selector, m.updateOperators(dataName, bson.M{softDeleteField: m.now()}, false))
+}
+
+// Restore bring back a soft deleted item
+func (m *mongoHandler) Restore(dataName string, id interface{}) error {
+	call := &Call{Operation: OperationRestore, DataName: dataName, ID: id}
+	_, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, m.restore(call.DataName, call.ID)
+	})
+	return err
+}
+
+func (m *mongoHandler) restore(dataName string, id interface{}) error {
+	if !m.configOf(dataName).softDelete {
+		return ErrSoftDeleteDisabled
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for restoring item %s. %s\n", id, err)
+		return err
+	}
+	// Make sure to use correct object id
+	objectID, err := createObjectID(id)
+	if err != nil {
+		log.Printf("[App.db]: Error during create object id %s. %s\n", id, err)
+		return err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	selector := m.tenantFilter(bson.M{"_id": objectID, softDeleteField: bson.M{"$ne": nil}})
+	tracker, err := m.trackRevisions(ctx, c, dataName, RevisionRestore, selector, 1)
+	if err != nil {
+		return err
+	}
+	operators := m.updateOperators(dataName, bson.M{}, false)
+	if set, _ := operators["$set"].(map[string]interface{}); len(set) == 0 {
+		delete(operators, "$set")
+	}
+	operators["$unset"] = bson.M{softDeleteField: ""}
+	err = updateOne(ctx, c, selector, operators)
+	if err != nil {
+		return err
+	}
+	tracker.record()
+	return nil
+}
+
+// Purge permanently remove items soft deleted more than olderThan ago
+// and return number of removed items
+func (m *mongoHandler) Purge(dataName string, olderThan time.Duration) (int, error) {
+	call := &Call{Operation: OperationPurge, DataName: dataName, OlderThan: olderThan}
+	result, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return m.purge(call.DataName, call.OlderThan)
+	})
+	removed, _ := result.(int)
+	return removed, err
+}
+
+func (m *mongoHandler) purge(dataName string, olderThan time.Duration) (int, error) {
+	if !m.configOf(dataName).softDelete {
+		return 0, ErrSoftDeleteDisabled
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for purging %s. %s\n", dataName, err)
+		return 0, err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	c := m.collection(dataName)
+	selector := m.tenantFilter(bson.M{softDeleteField: bson.M{"$lte": m.now().Add(-olderThan)}})
+	tracker, err := m.trackRevisions(ctx, c, dataName, RevisionPurge, selector, 0)
+	if err != nil {
+		return 0, err
+	}
+	rs, err := c.DeleteMany(ctx, tracker.selector(selector))
+	if err != nil {
+		log.Printf("[App.db]: Error during purging %s. %s\n", dataName, err)
+		return 0, err
+	}
+	tracker.record()
+	return int(rs.DeletedCount), nil
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+const fixtureFirstMessageID = "5b8f5bd2a7e3b5a0c4a1f001"
+
+func newSoftDeleteTestHandler(t *testing.T) *mongoHandler {
+	dbhandler := newTestHandler(t, collectionName)
+	WithSoftDelete(collectionName)(dbhandler)
+	return dbhandler
+}
+
+func TestSoftDeleteRemoveItemByID(t *testing.T) {
+	dbhandler := newSoftDeleteTestHandler(t)
+	err := dbhandler.RemoveItemByID(collectionName, fixtureFirstMessageID)
+	if err != nil {
+		t.Fatalf("Remove must not return error but got %s", err.Error())
+	}
+	if _, err = dbhandler.FindItemByID(collectionName, fixtureFirstMessageID); err == nil {
+		t.Fatalf("After soft deleting, find must return error")
+	}
+	total, err := dbhandler.GetTotal(collectionName, map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Error when counting items %s", err.Error())
+	}
+	if total != 2 {
+		t.Fatalf("Soft deleted item must not be counted, got total %d", total)
+	}
+	trash, err := dbhandler.GetAllItemsNoLimit(collectionName, map[string]interface{}{
+		softDeleteField: map[string]interface{}{"$ne": nil},
+	})
+	if err != nil {
+		t.Fatalf("Error when get trashed items %s", err.Error())
+	}
+	if len(trash) != 1 || trash[0]["_id"] != fixtureFirstMessageID {
+		t.Fatalf("Soft deleted item must be kept in the collection, got %v", trash)
+	}
+	if err = dbhandler.RemoveItemByID(collectionName, fixtureFirstMessageID); err == nil {
+		t.Fatalf("Removing a soft deleted item again must return error")
+	}
+}
+
+func TestSoftDeleteRestore(t *testing.T) {
+	dbhandler := newSoftDeleteTestHandler(t)
+	if err := dbhandler.RemoveItemBy(collectionName, map[string]interface{}{"category": "like"}); err != nil {
+		t.Fatalf("Remove must not return error but got %s", err.Error())
+	}
+	if _, err := dbhandler.FindBy(collectionName, map[string]interface{}{"category": "like"}); err == nil {
+		t.Fatalf("After soft deleting, find must return error")
+	}
+	if err := dbhandler.Restore(collectionName, "5b8f5bd2a7e3b5a0c4a1f003"); err != nil {
+		t.Fatalf("Restore must not return error but got %s", err.Error())
+	}
+	if _, err := dbhandler.FindBy(collectionName, map[string]interface{}{"category": "like"}); err != nil {
+		t.Fatalf("Restored item must be found but got %s", err.Error())
+	}
+	if err := dbhandler.Restore(collectionName, "5b8f5bd2a7e3b5a0c4a1f003"); err == nil {
+		t.Fatalf("Restoring an item which is not deleted must return error")
+	}
+}
+
+func TestSoftDeletePurge(t *testing.T) {
+	dbhandler := newSoftDeleteTestHandler(t)
+	if err := dbhandler.RemoveItemByID(collectionName, fixtureFirstMessageID); err != nil {
+		t.Fatalf("Remove must not return error but got %s", err.Error())
+	}
+	removed, err := dbhandler.Purge(collectionName, time.Hour)
+	if err != nil {
+		t.Fatalf("Purge must not return error but got %s", err.Error())
+	}
+	if removed != 0 {
+		t.Fatalf("Purge must keep recently deleted items, removed %d", removed)
+	}
+	removed, err = dbhandler.Purge(collectionName, 0)
+	if err != nil {
+		t.Fatalf("Purge must not return error but got %s", err.Error())
+	}
+	if removed != 1 {
+		t.Fatalf("Purge must remove deleted items, removed %d", removed)
+	}
+	if err = dbhandler.Restore(collectionName, fixtureFirstMessageID); err == nil {
+		t.Fatalf("Purged item cannot be restored")
+	}
+}
+
+func TestSoftDeleteDisabled(t *testing.T) {
+	dbhandler := NewMongoHandler(dbHost, dbName, authDb, dbUser, dbPass, dbPort, 0, WithSoftDelete("other"))
+	if err := dbhandler.Restore(collectionName, fixtureFirstMessageID); err != ErrSoftDeleteDisabled {
+		t.Fatalf("Expected %v but got %v", ErrSoftDeleteDisabled, err)
+	}
+	if _, err := dbhandler.Purge(collectionName, 0); err != ErrSoftDeleteDisabled {
+		t.Fatalf("Expected %v but got %v", ErrSoftDeleteDisabled, err)
+	}
+}
+
+func TestScopeFilter(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	WithSoftDelete(collectionName)(dbhandler)
+	filters := map[string]interface{}{"actorID": 1}
+	scoped := dbhandler.scopeFilter(collectionName, filters)
+	if _, ok := scoped[softDeleteField]; !ok || len(filters) != 1 {
+		t.Fatalf("Scoped filter must exclude deleted items without modifying original filter, got %v", scoped)
+	}
+	trash := map[string]interface{}{softDeleteField: map[string]interface{}{"$ne": nil}}
+	if scoped = dbhandler.scopeFilter(collectionName, trash); scoped[softDeleteField] == nil {
+		t.Fatalf("Explicit filter on %s must be kept, got %v", softDeleteField, scoped)
+	}
+	if scoped = dbhandler.scopeFilter("other", filters); len(scoped) != 1 {
+		t.Fatalf("Collections without soft delete must not be scoped, got %v", scoped)
+	}
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultTenantField default field storing the tenant of shared collections
+const DefaultTenantField = "tenantId"
+
+// ErrInvalidTenant is returned by calls of a view scoped to an empty tenant
+// or to a tenant which cannot name a database
+var ErrInvalidTenant = errors.New("Wrong tenant id")
+
+// ErrTenantMismatch is returned when a document of a tenant view belongs to
+// another tenant
+var ErrTenantMismatch = errors.New("Document belongs to another tenant")
+
+// tenancy how tenant views isolate tenants
+type tenancy struct {
+	field       string
+	perDatabase bool
+}
+
+// WithTenantField change the field storing the tenant of shared collections
+func WithTenantField(field string) Option {
+	return func(m *mongoHandler) {
+		m.tenancy.field = field
+	}
+}
+
+// WithDatabasePerTenant route tenant views to their own database named
+// <database>_<tenant id> instead of filtering shared collections
+func WithDatabasePerTenant() Option {
+	return func(m *mongoHandler) {
+		m.tenancy.perDatabase = true
+	}
+}
+
+// ForTenant get a view of the handler restricted to the items of a tenant.
+// Reads, updates and removals only match items of the tenant, inserted
+// items are stamped with it and documents of other tenants are rejected.
+// Calls of a tenant view scoped to another tenant fail with ErrInvalidTenant
+func (m *mongoHandler) ForTenant(id string) DatabaseHandler {
+	view := m.view()
+	if m.tenant != nil {
+		if id != *m.tenant {
+			view.tenantErr = fmt.Errorf("%w: view of %q cannot be scoped to %q", ErrInvalidTenant, *m.tenant, id)
+		}
+		return view
+	}
+	view.tenant = &id
+	view.database = view.tenantDatabase(m.database)
+	return view
+}
+
+// tenantDatabase get the database of the tenant when tenants have their own
+// database, database otherwise
+func (m *mongoHandler) tenantDatabase(database string) string {
+	if m.tenant == nil || !m.tenancy.perDatabase {
+		return database
+	}
+	return database + "_" + *m.tenant
+}
+
+// tenantField get the field storing the tenant, empty when calls are not
+// scoped by field
+func (m *mongoHandler) tenantField() string {
+	if m.tenant == nil || m.tenancy.perDatabase {
+		return ""
+	}
+	if m.tenancy.field == "" {
+		return DefaultTenantField
+	}
+	return m.tenancy.field
+}
+
+// validateTenant check the tenant of the view can scope calls
+func (m *mongoHandler) validateTenant() error {
+	if m.tenant == nil {
+		return nil
+	}
+	if m.tenantErr != nil {
+		return m.tenantErr
+	}
+	id := *m.tenant
+	if id == "" || m.tenancy.perDatabase && strings.ContainsAny(id, forbiddenDatabaseChars) {
+		return fmt.Errorf("%w: %q", ErrInvalidTenant, id)
+	}
+	return nil
+}
+
+// tenantFilter restrict filters to the items of the tenant. Filters already
+// on the tenant field are combined so they cannot widen the scope
+func (m *mongoHandler) tenantFilter(filters map[string]interface{}) map[string]interface{} {
+	field := m.tenantField()
+	if field == "" {
+		return filters
+	}
+	if _, ok := filters[field]; ok {
+		return bson.M{"$and": []interface{}{filters, bson.M{field: *m.tenant}}}
+	}
+	scoped := cloneStringMap(filters)
+	scoped[field] = *m.tenant
+	return scoped
+}
+
+// tenantDocument get a copy of doc stamped with the tenant, failing when doc
+// belongs to another tenant
+func (m *mongoHandler) tenantDocument(doc map[string]interface{}) (map[string]interface{}, error) {
+	field := m.tenantField()
+	if field == "" || doc == nil {
+		return doc, nil
+	}
+	if tenant, ok := doc[field]; ok && tenant != *m.tenant {
+		return nil, fmt.Errorf("%w: %s is %v", ErrTenantMismatch, field, tenant)
+	}
+	stamped := cloneStringMap(doc)
+	stamped[field] = *m.tenant
+	return stamped, nil
+}
+
+// scopeTenant validate the tenant of the view and stamp it on the document
+// of the call
+func (m *mongoHandler) scopeTenant(call *Call) error {
+	if m.tenant == nil {
+		return nil
+	}
+	if err := m.validateTenant(); err != nil {
+		return err
+	}
+	var err error
+	call.Document, err = m.tenantDocument(call.Document)
+	return err
+}
+
+// tenantRevisionFilter restrict history filters to revisions of items of
+// the tenant
+func (m *mongoHandler) tenantRevisionFilter(filters map[string]interface{}) map[string]interface{} {
+	field := m.tenantField()
+	if field == "" {
+		return filters
+	}
+	return bson.M{"$and": []interface{}{filters, bson.M{"$or": []interface{}{
+		bson.M{"before." + field: *m.tenant},
+		bson.M{"after." + field: *m.tenant},
+	}}}}
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestTenantView(t *testing.T) {
+	dbhandler := &mongoHandler{database: "notifications"}
+	view := dbhandler.ForTenant("acme").(*mongoHandler)
+	expected := map[string]interface{}{"seen": false, DefaultTenantField: "acme"}
+	if filter := view.scopeFilter(collectionName, map[string]interface{}{"seen": false}); !reflect.DeepEqual(filter, expected) {
+		t.Fatalf("Expected filter %v but got %v", expected, filter)
+	}
+	widened := map[string]interface{}{DefaultTenantField: map[string]interface{}{"$ne": nil}}
+	if filter := view.scopeFilter(collectionName, widened); !reflect.DeepEqual(filter["$and"], []interface{}{widened, bson.M{DefaultTenantField: "acme"}}) {
+		t.Fatalf("Filters on the tenant field must not widen the scope, got %v", filter)
+	}
+	if filter := dbhandler.scopeFilter(collectionName, map[string]interface{}{}); len(filter) != 0 {
+		t.Fatalf("Root handler must not be scoped, got %v", filter)
+	}
+	var document map[string]interface{}
+	item := map[string]interface{}{"content": "hello"}
+	_, err := view.intercept(&Call{Operation: OperationAddNewItem, DataName: collectionName, Document: item}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		document = call.Document
+		if call.Tenant != "acme" {
+			t.Fatalf("Calls of tenant views must have their tenant, got %q", call.Tenant)
+		}
+		return nil, nil
+	})
+	if err != nil || document[DefaultTenantField] != "acme" || len(item) != 1 {
+		t.Fatalf("Documents must be stamped on a copy, got %v and %v", document, err)
+	}
+	_, err = view.intercept(&Call{Operation: OperationUpdateByID, DataName: collectionName, Document: map[string]interface{}{DefaultTenantField: "other"}}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		t.Fatalf("Calls moving items to another tenant must not run")
+		return nil, nil
+	})
+	if !errors.Is(err, ErrTenantMismatch) || errorClass(err) != "invalid_argument" {
+		t.Fatalf("Changing the tenant must return ErrTenantMismatch but got %v", err)
+	}
+}
+
+func TestTenantViewPerDatabase(t *testing.T) {
+	dbhandler := &mongoHandler{database: "notifications"}
+	WithDatabasePerTenant()(dbhandler)
+	view := dbhandler.ForTenant("acme").(*mongoHandler)
+	if view.database != "notifications_acme" || dbhandler.database != "notifications" {
+		t.Fatalf("Tenant views must use their own database, got %s", view.database)
+	}
+	if filter := view.scopeFilter(collectionName, map[string]interface{}{}); len(filter) != 0 {
+		t.Fatalf("Tenant databases must not be filtered, got %v", filter)
+	}
+	if same := view.ForTenant("acme").(*mongoHandler); same.database != "notifications_acme" {
+		t.Fatalf("Scoping a view to its tenant must keep its database, got %s", same.database)
+	}
+	nested := view.ForTenant("globex").(*mongoHandler)
+	if nested.database != "notifications_acme" {
+		t.Fatalf("Tenant views must not be moved to another tenant database, got %s", nested.database)
+	}
+	_, err := nested.intercept(&Call{Operation: OperationFindBy}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		t.Fatalf("Calls of tenant views scoped to another tenant must not run")
+		return nil, nil
+	})
+	if !errors.Is(err, ErrInvalidTenant) {
+		t.Fatalf("Tenant views scoped to another tenant must return ErrInvalidTenant but got %v", err)
+	}
+	for _, id := range []string{"", "acme.users", "a/b"} {
+		_, err := dbhandler.ForTenant(id).(*mongoHandler).intercept(&Call{Operation: OperationFindBy}, func(m *mongoHandler, call *Call) (interface{}, error) {
+			return nil, nil
+		})
+		if !errors.Is(err, ErrInvalidTenant) {
+			t.Fatalf("Tenant %q must return ErrInvalidTenant but got %v", id, err)
+		}
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	acme := dbhandler.ForTenant("acme")
+	globex := dbhandler.ForTenant("globex")
+	inserted, err := acme.AddNewItem(collectionName, map[string]interface{}{"content": "hello", "seen": false})
+	if err != nil {
+		t.Fatalf("Insert must not return error but got %s", err.Error())
+	}
+	if _, err = globex.FindItemByID(collectionName, inserted["_id"]); err != ErrNotFound {
+		t.Fatalf("Items of other tenants must not be found, got %v", err)
+	}
+	if _, err = globex.UpdateBy(collectionName, map[string]interface{}{"seen": false}, map[string]interface{}{"seen": true}); err != nil {
+		t.Fatalf("Update must not return error but got %s", err.Error())
+	}
+	item, err := acme.FindItemByID(collectionName, inserted["_id"])
+	if err != nil || item["seen"] != false || item[DefaultTenantField] != "acme" {
+		t.Fatalf("Items must only be changed by their tenant, got %v and %v", item, err)
+	}
+	if total, _ := acme.GetTotal(collectionName, map[string]interface{}{}); total != 1 {
+		t.Fatalf("Tenant must only count its items, got %d", total)
+	}
+	if err = globex.RemoveItemByID(collectionName, inserted["_id"]); err != ErrNotFound {
+		t.Fatalf("Items of other tenants must not be removed, got %v", err)
+	}
+	if err = acme.UpdateByID(collectionName, inserted["_id"], map[string]interface{}{DefaultTenantField: "globex"}); !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("Moving items to another tenant must return ErrTenantMismatch but got %v", err)
+	}
+}
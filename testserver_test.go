@@ -0,0 +1,242 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// testServerBinary is the mongod executable looked up on PATH
+	testServerBinary = "mongod"
+	// testFixturesDir holds json fixtures, one file per collection
+	testFixturesDir = "testdata/fixtures"
+	// testServerStartTimeout bounds how long we wait for mongod to accept connections
+	testServerStartTimeout = 30 * time.Second
+)
+
+// testServer is a disposable mongod process shared by all tests of the package
+type testServer struct {
+	cmd    *exec.Cmd
+	port   int
+	dbPath string
+}
+
+var (
+	sharedTestServer     *testServer
+	sharedTestServerErr  error
+	sharedTestServerOnce sync.Once
+	testDatabaseCounter  uint64
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if sharedTestServer != nil {
+		sharedTestServer.stop()
+	}
+	os.Exit(code)
+}
+
+// startTestServer starts mongod on a random local port with a temporary data directory
+func startTestServer() (*testServer, error) {
+	binary, err := exec.LookPath(testServerBinary)
+	if err != nil {
+		return nil, fmt.Errorf("%s binary not found on PATH", testServerBinary)
+	}
+	port, err := freeLocalPort()
+	if err != nil {
+		return nil, fmt.Errorf("cannot reserve a local port: %s", err)
+	}
+	dbPath, err := os.MkdirTemp("", "go-mongo-handler-")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create data directory: %s", err)
+	}
+	cmd := exec.Command(binary,
+		"--port", strconv.Itoa(port),
+		"--bind_ip", "127.0.0.1",
+		"--dbpath", dbPath,
+		"--nounixsocket",
+		"--quiet",
+	)
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dbPath)
+		return nil, fmt.Errorf("cannot start %s: %s", binary, err)
+	}
+	server := &testServer{cmd: cmd, port: port, dbPath: dbPath}
+	if err := server.waitReady(); err != nil {
+		server.stop()
+		return nil, err
+	}
+	return server, nil
+}
+
+// waitReady polls the server until it accepts connections
+func (s *testServer) waitReady() error {
+	deadline := time.Now().Add(testServerStartTimeout)
+	for {
+		err := s.ping()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("mongod did not accept connections on %s: %s", s.address(), err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// ping connect to the server and check it answers
+func (s *testServer) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().SetHosts([]string{s.address()}).SetDirect(true).SetServerSelectionTimeout(time.Second))
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	return client.Ping(ctx, nil)
+}
+
+func (s *testServer) address() string {
+	return "127.0.0.1:" + strconv.Itoa(s.port)
+}
+
+func (s *testServer) stop() {
+	if s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+		s.cmd.Wait()
+	}
+	os.RemoveAll(s.dbPath)
+}
+
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// requireTestServer returns the shared server, skipping the test when it cannot be started
+func requireTestServer(t *testing.T) *testServer {
+	t.Helper()
+	sharedTestServerOnce.Do(func() {
+		sharedTestServer, sharedTestServerErr = startTestServer()
+	})
+	if sharedTestServerErr != nil {
+		t.Skipf("Skipping test that needs a disposable mongod: %s", sharedTestServerErr)
+	}
+	return sharedTestServer
+}
+
+// newTestHandler creates a handler bound to an isolated database on the shared
+// test server, loads the given fixtures and drops the database on cleanup.
+// Each fixture name refers to testdata/fixtures/<name>.json and is loaded into
+// the collection of the same name.
+func newTestHandler(t *testing.T, fixtures ...string) *mongoHandler {
+	t.Helper()
+	server := requireTestServer(t)
+	dbhandler := &mongoHandler{
+		host:     "127.0.0.1",
+		port:     server.port,
+		database: testDatabaseName(t),
+	}
+	if err := dbhandler.GetConnection(); err != nil {
+		t.Fatalf("Fail to init db session: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		if dbhandler.connection != nil {
+			dbhandler.connection.Database(dbhandler.database).Drop(context.Background())
+		}
+		dbhandler.CloseConnection()
+	})
+	for _, fixture := range fixtures {
+		loadFixture(t, dbhandler, fixture)
+	}
+	return dbhandler
+}
+
+// testDatabaseName builds a unique database name which stays under the 64 bytes limit
+func testDatabaseName(t *testing.T) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, t.Name())
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return fmt.Sprintf("test_%s_%d", name, atomic.AddUint64(&testDatabaseCounter, 1))
+}
+
+// loadFixture inserts documents of a fixture file. Files contain a json array
+// of documents and may use extended json such as {"$oid": "..."}.
+func loadFixture(t *testing.T, dbhandler *mongoHandler, fixture string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(testFixturesDir, fixture+".json"))
+	if err != nil {
+		t.Fatalf("Fail to read fixture %s: %s", fixture, err)
+	}
+	// Extended json only has documents at the top level
+	var fixtureDoc struct {
+		Docs []bson.M `bson:"docs"`
+	}
+	data = append(append([]byte(`{"docs":`), data...), '}')
+	if err := bson.UnmarshalExtJSON(data, false, &fixtureDoc); err != nil {
+		t.Fatalf("Fail to parse fixture %s: %s", fixture, err)
+	}
+	if len(fixtureDoc.Docs) == 0 {
+		return
+	}
+	items := make([]interface{}, len(fixtureDoc.Docs))
+	for index, doc := range fixtureDoc.Docs {
+		items[index] = doc
+	}
+	c := dbhandler.connection.Database(dbhandler.database).Collection(fixture)
+	if _, err := c.InsertMany(context.Background(), items); err != nil {
+		t.Fatalf("Fail to load fixture %s: %s", fixture, err)
+	}
+}
+
+// mustObjectID parse a hex object id known to be valid
+func mustObjectID(hex string) primitive.ObjectID {
+	objectID, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		panic(err)
+	}
+	return objectID
+}
+
+func TestNewTestHandlerLoadsFixtures(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	total, err := dbhandler.GetTotal(collectionName, map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Error when counting fixtures %s", err.Error())
+	}
+	if total != 3 {
+		t.Fatalf("Expected 3 fixture documents but got %d", total)
+	}
+	found, err := dbhandler.FindItemByID(collectionName, "5b8f5bd2a7e3b5a0c4a1f001")
+	if err != nil {
+		t.Fatalf("Error during find fixture by ID: %s", err.Error())
+	}
+	if found["content"] != "First fixture message" {
+		t.Fatalf("Unexpected fixture document %v", found)
+	}
+}
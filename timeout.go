@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// writeConcernTimeoutCode server error code when wtimeout is exceeded
+const writeConcernTimeoutCode = 64
+
+// TimeoutError is returned when an operation exceeds its server side max
+// time or its client side socket timeout
+type TimeoutError struct {
+	err error
+}
+
+func (e TimeoutError) Error() string {
+	return "Operation timed out: " + e.err.Error()
+}
+
+// Timeout always true, TimeoutError satisfies net.Error style checks
+func (e TimeoutError) Timeout() bool {
+	return true
+}
+
+// Unwrap get the driver error which caused the timeout
+func (e TimeoutError) Unwrap() error {
+	return e.err
+}
+
+// WithMaxTime set the default server side time limit (maxTimeMS) of reads
+func WithMaxTime(maxTime time.Duration) Option {
+	return func(m *mongoHandler) {
+		m.maxTime = maxTime
+	}
+}
+
+// WithSocketTimeout set the default client side timeout of reads and writes
+// on sockets, which also bounds writes since they have no server side limit
+func WithSocketTimeout(socketTimeout time.Duration) Option {
+	return func(m *mongoHandler) {
+		m.socketTimeout = socketTimeout
+	}
+}
+
+// WithTimeouts get a view of the handler overriding default time limits,
+// zero keeps the default. A deadline of the context given with WithContext
+// further bounds both limits
+func (m *mongoHandler) WithTimeouts(maxTime, socketTimeout time.Duration) DatabaseHandler {
+	view := m.view()
+	if maxTime > 0 {
+		view.maxTime = maxTime
+	}
+	if socketTimeout > 0 {
+		view.socketTimeout = socketTimeout
+	}
+	return view
+}
+
+// timeouts get time limits of the handler bounded by the context deadline
+func (m *mongoHandler) timeouts() (maxTime, socketTimeout time.Duration) {
+	maxTime, socketTimeout = m.maxTime, m.socketTimeout
+	if deadline, ok := m.context().Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining < time.Millisecond {
+			remaining = time.Millisecond
+		}
+		if maxTime == 0 || remaining < maxTime {
+			maxTime = remaining
+		}
+		if socketTimeout == 0 || remaining < socketTimeout {
+			socketTimeout = remaining
+		}
+	}
+	return maxTime, socketTimeout
+}
+
+// operationContext get the context of an operation, cancelled once the
+// socket timeout of the handler is exceeded
+func (m *mongoHandler) operationContext() (context.Context, context.CancelFunc) {
+	if _, socketTimeout := m.timeouts(); socketTimeout > 0 {
+		return context.WithTimeout(m.context(), socketTimeout)
+	}
+	return context.WithCancel(m.context())
+}
+
+// readMaxTime get the server side time limit of reads, 0 means no limit
+func (m *mongoHandler) readMaxTime() time.Duration {
+	maxTime, _ := m.timeouts()
+	return maxTime
+}
+
+// timeoutError convert driver errors caused by time limits into TimeoutError
+func timeoutError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(TimeoutError); ok {
+		return err
+	}
+	if mongo.IsTimeout(err) || isWriteConcernTimeout(err) {
+		return TimeoutError{err: err}
+	}
+	return err
+}
+
+// isWriteConcernTimeout tell whether a write was not acknowledged in wtimeout
+func isWriteConcernTimeout(err error) bool {
+	var concernErr *mongo.WriteConcernError
+	switch e := err.(type) {
+	case mongo.WriteException:
+		concernErr = e.WriteConcernError
+	case mongo.BulkWriteException:
+		concernErr = e.WriteConcernError
+	}
+	return concernErr != nil && concernErr.Code == writeConcernTimeoutCode
+}
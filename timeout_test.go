@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type netTimeout struct{}
+
+func (netTimeout) Error() string   { return "i/o timeout" }
+func (netTimeout) Timeout() bool   { return true }
+func (netTimeout) Temporary() bool { return true }
+
+func TestTimeoutError(t *testing.T) {
+	expired := mongo.CommandError{Code: 50, Message: "operation exceeded time limit"}
+	writeExpired := mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{Code: 50}}
+	for _, err := range []error{expired, writeExpired, netTimeout{}} {
+		converted, ok := timeoutError(err).(TimeoutError)
+		if !ok {
+			t.Fatalf("%v must be converted to TimeoutError", err)
+		}
+		if !reflect.DeepEqual(converted.Unwrap(), err) || errorClass(converted) != "timeout" {
+			t.Fatalf("TimeoutError must wrap %v and be classified as timeout", err)
+		}
+	}
+	other := mongo.CommandError{Code: 2, Message: "bad query"}
+	if !reflect.DeepEqual(timeoutError(other), other) || timeoutError(ErrNotFound) != ErrNotFound {
+		t.Fatalf("Other errors must be kept as they are")
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	WithMaxTime(2 * time.Second)(dbhandler)
+	WithSocketTimeout(5 * time.Second)(dbhandler)
+	if maxTime, socketTimeout := dbhandler.timeouts(); maxTime != 2*time.Second || socketTimeout != 5*time.Second {
+		t.Fatalf("Expected default timeouts but got %s and %s", maxTime, socketTimeout)
+	}
+	view := dbhandler.WithTimeouts(time.Second, 0).(*mongoHandler)
+	if maxTime, socketTimeout := view.timeouts(); maxTime != time.Second || socketTimeout != 5*time.Second {
+		t.Fatalf("Expected overridden max time but got %s and %s", maxTime, socketTimeout)
+	}
+	if maxTime, _ := dbhandler.timeouts(); maxTime != 2*time.Second {
+		t.Fatalf("Overrides must not change the handler, got %s", maxTime)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	maxTime, socketTimeout := view.WithContext(ctx).(*mongoHandler).timeouts()
+	if maxTime > 500*time.Millisecond || socketTimeout > 500*time.Millisecond || maxTime <= 0 {
+		t.Fatalf("Timeouts must be bounded by the context deadline, got %s and %s", maxTime, socketTimeout)
+	}
+}
+
+func TestInterceptExpiredContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	view := (&mongoHandler{}).WithContext(ctx).(*mongoHandler)
+	invoked := false
+	_, err := view.intercept(&Call{Operation: OperationFindBy, DataName: collectionName}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		invoked = true
+		return nil, nil
+	})
+	if _, ok := err.(TimeoutError); !ok || invoked {
+		t.Fatalf("Calls with an expired deadline must fail with TimeoutError without running, got %v", err)
+	}
+}
+
+func TestMaxTime(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	slow := map[string]interface{}{"$where": "sleep(100) || true"}
+	_, err := dbhandler.WithTimeouts(time.Millisecond, 0).FindBy(collectionName, slow)
+	if _, ok := err.(TimeoutError); !ok {
+		t.Fatalf("Queries exceeding max time must return TimeoutError but got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DefaultCreatedAtField default field storing creation time
+	DefaultCreatedAtField = "createdAt"
+	// DefaultUpdatedAtField default field storing last modification time
+	DefaultUpdatedAtField = "updatedAt"
+)
+
+// timestampConfig names of the fields automatically stamped on write
+type timestampConfig struct {
+	createdField string
+	updatedField string
+}
+
+// WithTimestamps enable automatic createdAt/updatedAt stamping. Empty field
+// names fall back to DefaultCreatedAtField and DefaultUpdatedAtField
+func WithTimestamps(createdField, updatedField string) Option {
+	if createdField == "" {
+		createdField = DefaultCreatedAtField
+	}
+	if updatedField == "" {
+		updatedField = DefaultUpdatedAtField
+	}
+	return func(m *mongoHandler) {
+		m.timestamps = &timestampConfig{createdField: createdField, updatedField: updatedField}
+	}
+}
+
+// WithoutTimestamps disable automatic timestamps for the given collections
+func WithoutTimestamps(dataNames ...string) Option {
+	return func(m *mongoHandler) {
+		for _, dataName := range dataNames {
+			m.collectionConfig(dataName).noTimestamps = true
+		}
+	}
+}
+
+// WithClock replace the clock used for timestamps and soft delete markers,
+// mostly useful in tests
+func WithClock(clock func() time.Time) Option {
+	return func(m *mongoHandler) {
+		m.clock = clock
+	}
+}
+
+func (m *mongoHandler) now() time.Time {
+	if m.clock != nil {
+		return m.clock()
+	}
+	return time.Now()
+}
+
+// timestampsOf get timestamp fields of a collection, nil when disabled
+func (m *mongoHandler) timestampsOf(dataName string) *timestampConfig {
+	if m.timestamps == nil || m.configOf(dataName).noTimestamps {
+		return nil
+	}
+	return m.timestamps
+}
+
+// stampNewDocument set creation and modification time of a document
+// about to be inserted, keeping a creation time provided by the caller
+func (m *mongoHandler) stampNewDocument(dataName string, doc map[string]interface{}) {
+	stamps := m.timestampsOf(dataName)
+	if stamps == nil {
+		return
+	}
+	now := m.now()
+	if createdAt, ok := doc[stamps.createdField]; !ok || createdAt == nil {
+		doc[stamps.createdField] = now
+	}
+	if _, ok := doc[stamps.updatedField]; !ok {
+		doc[stamps.updatedField] = now
+	}
+}
+
+// stampReplacement set modification time of a replacement document and
+// carry over the creation time of the stored item, which callers do not send
+func (m *mongoHandler) stampReplacement(ctx context.Context, c *mongo.Collection, dataName string, objectID primitive.ObjectID, doc map[string]interface{}) error {
+	stamps := m.timestampsOf(dataName)
+	if stamps == nil {
+		return nil
+	}
+	doc[stamps.updatedField] = m.now()
+	var stored bson.M
+	err := m.findOne(ctx, c, m.scopeFilter(dataName, bson.M{"_id": objectID}), &stored, options.FindOne().SetProjection(bson.M{stamps.createdField: 1}))
+	if err == ErrNotFound {
+		// The replacement reports missing items
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if createdAt, ok := stored[stamps.createdField]; ok {
+		doc[stamps.createdField] = createdAt
+	}
+	return nil
+}
+
+// updateOperators build update operators setting fields of update,
+// bumping version of versioned collections and refreshing modification time.
+// Server time is used through $currentDate unless a clock is injected.
+// upsert also sets creation time on insert
+func (m *mongoHandler) updateOperators(dataName string, update map[string]interface{}, upsert bool) bson.M {
+	operators := bson.M{"$set": update}
+	if field := m.versionFieldOf(dataName); field != "" {
+		set := cloneStringMap(update)
+		delete(set, field)
+		update = set
+		operators["$set"] = set
+		operators["$inc"] = bson.M{field: 1}
+	}
+	stamps := m.timestampsOf(dataName)
+	if stamps == nil {
+		return operators
+	}
+	if _, ok := update[stamps.updatedField]; !ok {
+		if m.clock != nil {
+			set := cloneStringMap(update)
+			set[stamps.updatedField] = m.now()
+			operators["$set"] = set
+		} else {
+			operators["$currentDate"] = bson.M{stamps.updatedField: true}
+		}
+	}
+	if _, ok := update[stamps.createdField]; upsert && !ok {
+		operators["$setOnInsert"] = bson.M{stamps.createdField: m.now()}
+	}
+	return operators
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var testClockTime = time.Date(2018, 9, 7, 10, 0, 0, 0, time.UTC)
+
+func testClock() time.Time {
+	return testClockTime
+}
+
+func TestWithTimestampsDefaultFields(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	WithTimestamps("", "modifiedAt")(dbhandler)
+	expected := &timestampConfig{createdField: DefaultCreatedAtField, updatedField: "modifiedAt"}
+	if !reflect.DeepEqual(dbhandler.timestamps, expected) {
+		t.Fatalf("Expected %v but got %v", expected, dbhandler.timestamps)
+	}
+}
+
+func TestStampNewDocument(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	WithTimestamps("", "")(dbhandler)
+	WithClock(testClock)(dbhandler)
+	WithoutTimestamps("logs")(dbhandler)
+	providedCreatedAt := testClockTime.Add(-time.Hour)
+	doc := map[string]interface{}{"createdAt": providedCreatedAt}
+	dbhandler.stampNewDocument(collectionName, doc)
+	expected := map[string]interface{}{"createdAt": providedCreatedAt, "updatedAt": testClockTime}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("Expected %v but got %v", expected, doc)
+	}
+	doc = map[string]interface{}{}
+	dbhandler.stampNewDocument("logs", doc)
+	if len(doc) != 0 {
+		t.Fatalf("Collections opted out must not be stamped, got %v", doc)
+	}
+}
+
+func TestUpdateOperators(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	update := map[string]interface{}{"seen": true}
+	if operators := dbhandler.updateOperators(collectionName, update, true); !reflect.DeepEqual(operators, bson.M{"$set": update}) {
+		t.Fatalf("Update must only set fields when timestamps disabled, got %v", operators)
+	}
+	WithTimestamps("", "")(dbhandler)
+	expected := bson.M{
+		"$set":         update,
+		"$currentDate": bson.M{"updatedAt": true},
+	}
+	if operators := dbhandler.updateOperators(collectionName, update, false); !reflect.DeepEqual(operators, expected) {
+		t.Fatalf("Expected %v but got %v", expected, operators)
+	}
+	WithClock(testClock)(dbhandler)
+	expected = bson.M{
+		"$set":         map[string]interface{}{"seen": true, "updatedAt": testClockTime},
+		"$setOnInsert": bson.M{"createdAt": testClockTime},
+	}
+	if operators := dbhandler.updateOperators(collectionName, update, true); !reflect.DeepEqual(operators, expected) {
+		t.Fatalf("Expected %v but got %v", expected, operators)
+	}
+	if len(update) != 1 {
+		t.Fatalf("Update operators must not modify original update, got %v", update)
+	}
+}
+
+func TestTimestampsOnWrite(t *testing.T) {
+	dbhandler := newTestHandler(t)
+	WithTimestamps("", "")(dbhandler)
+	WithClock(testClock)(dbhandler)
+	inserted, err := dbhandler.AddNewItem(collectionName, map[string]interface{}{"content": "This is test message"})
+	if err != nil {
+		t.Fatalf("Insert item must not return error but got %s", err.Error())
+	}
+	found, err := dbhandler.FindItemByID(collectionName, inserted["_id"])
+	if err != nil {
+		t.Fatalf("Error during find message by ID: %s", err.Error())
+	}
+	if !testClockTime.Equal(found["createdAt"].(time.Time)) || !testClockTime.Equal(found["updatedAt"].(time.Time)) {
+		t.Fatalf("Inserted item must be stamped, got %v", found)
+	}
+	later := testClockTime.Add(time.Hour)
+	WithClock(func() time.Time { return later })(dbhandler)
+	_, err = dbhandler.UpdateBy(collectionName, map[string]interface{}{"_id": mustObjectID(inserted["_id"].(string))}, map[string]interface{}{"seen": true})
+	if err != nil {
+		t.Fatalf("Update by must not return error but got %s", err.Error())
+	}
+	found, err = dbhandler.FindItemByID(collectionName, inserted["_id"])
+	if err != nil {
+		t.Fatalf("Error during find message by ID: %s", err.Error())
+	}
+	if !testClockTime.Equal(found["createdAt"].(time.Time)) || !later.Equal(found["updatedAt"].(time.Time)) {
+		t.Fatalf("Update must only refresh updatedAt, got %v", found)
+	}
+}
+
+func TestTimestampsOnReplace(t *testing.T) {
+	dbhandler := newTestHandler(t)
+	WithTimestamps("", "")(dbhandler)
+	WithVersioning("versioned")(dbhandler)
+	later := testClockTime.Add(time.Hour)
+	for _, dataName := range []string{collectionName, "versioned"} {
+		WithClock(testClock)(dbhandler)
+		inserted, err := dbhandler.AddNewItem(dataName, map[string]interface{}{"content": "This is test message"})
+		if err != nil {
+			t.Fatalf("Insert item must not return error but got %s", err.Error())
+		}
+		WithClock(func() time.Time { return later })(dbhandler)
+		if err = dbhandler.UpdateByID(dataName, inserted["_id"], map[string]interface{}{"content": "changed"}); err != nil {
+			t.Fatalf("Update by id must not return error but got %s", err.Error())
+		}
+		found, err := dbhandler.FindItemByID(dataName, inserted["_id"])
+		if err != nil {
+			t.Fatalf("Error during find message by ID: %s", err.Error())
+		}
+		createdAt, _ := found["createdAt"].(time.Time)
+		if !testClockTime.Equal(createdAt) || !later.Equal(found["updatedAt"].(time.Time)) || found["content"] != "changed" {
+			t.Fatalf("Replacing items of %s must keep createdAt, got %v", dataName, found)
+		}
+	}
+}
+
+func TestUpsertBy(t *testing.T) {
+	dbhandler := newTestHandler(t, collectionName)
+	WithTimestamps("", "")(dbhandler)
+	upsertedID, err := dbhandler.UpsertBy(collectionName, map[string]interface{}{"actorID": 7}, map[string]interface{}{"seen": false})
+	if err != nil {
+		t.Fatalf("Upsert must not return error but got %s", err.Error())
+	}
+	found, err := dbhandler.FindItemByID(collectionName, upsertedID)
+	if err != nil {
+		t.Fatalf("Upserted item must be found but got %s", err.Error())
+	}
+	if _, ok := found["createdAt"].(time.Time); !ok {
+		t.Fatalf("Upserted item must have createdAt, got %v", found)
+	}
+	if _, ok := found["updatedAt"].(time.Time); !ok {
+		t.Fatalf("Upserted item must have updatedAt, got %v", found)
+	}
+	upsertedID, err = dbhandler.UpsertBy(collectionName, map[string]interface{}{"actorID": 7}, map[string]interface{}{"seen": true})
+	if err != nil {
+		t.Fatalf("Upsert must not return error but got %s", err.Error())
+	}
+	if upsertedID != "" {
+		t.Fatalf("Upserting an existing item must not insert, got id %s", upsertedID)
+	}
+}
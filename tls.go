@@ -0,0 +1,154 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Authentication mechanisms
+const (
+	AuthSCRAMSHA1   = "SCRAM-SHA-1"
+	AuthSCRAMSHA256 = "SCRAM-SHA-256"
+	AuthX509        = "MONGODB-X509"
+)
+
+// x509Source database of users authenticated by certificates
+const x509Source = "$external"
+
+var (
+	// ErrUnsupportedMechanism is returned when the driver cannot
+	// authenticate with the configured mechanism
+	ErrUnsupportedMechanism = errors.New("Unsupported authentication mechanism")
+	// ErrInvalidCA is returned when a CA bundle has no PEM certificate
+	ErrInvalidCA = errors.New("Wrong CA bundle, no PEM certificate found")
+)
+
+// TLSConfig TLS settings of connections to the server
+type TLSConfig struct {
+	// CAFile PEM bundle of CAs trusted to sign server certificates, system
+	// roots are used when empty
+	CAFile string
+	// CertificateFile PEM client certificate, required for x.509 auth
+	CertificateFile string
+	// KeyFile PEM private key of the client certificate, when it is not
+	// part of CertificateFile
+	KeyFile string
+	// ServerName name verified against server certificates, defaults to the
+	// host of each server
+	ServerName string
+	// SkipHostnameVerification accept server certificates issued for any
+	// name as long as they are signed by a trusted CA. For development only
+	SkipHostnameVerification bool
+}
+
+// WithTLS connect to the server over TLS
+func WithTLS(config TLSConfig) Option {
+	return func(m *mongoHandler) {
+		m.tls = &config
+	}
+}
+
+// WithAuthMechanism set the mechanism used to authenticate, x.509
+// authenticates with the client certificate of WithTLS and needs neither
+// username nor password
+func WithAuthMechanism(mechanism string) Option {
+	return func(m *mongoHandler) {
+		m.mechanism = mechanism
+	}
+}
+
+// config build the tls config used to connect to servers
+func (c TLSConfig) config() (*tls.Config, error) {
+	config := &tls.Config{ServerName: c.ServerName}
+	if c.CAFile != "" {
+		bundle, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(bundle) {
+			return nil, ErrInvalidCA
+		}
+	}
+	if c.CertificateFile != "" {
+		keyFile := c.KeyFile
+		if keyFile == "" {
+			keyFile = c.CertificateFile
+		}
+		certificate, err := tls.LoadX509KeyPair(c.CertificateFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	if c.SkipHostnameVerification {
+		// Verify the chain ourselves, only the name check is skipped
+		roots := config.RootCAs
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, roots)
+		}
+	}
+	return config, nil
+}
+
+// verifyChain verify server certificates are signed by roots
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	certificates := make([]*x509.Certificate, len(rawCerts))
+	for index, raw := range rawCerts {
+		certificate, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certificates[index] = certificate
+	}
+	if len(certificates) == 0 {
+		return errors.New("Server sent no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err := certificates[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
+
+// secure set up TLS and credentials of client options
+func (m *mongoHandler) secure(clientOptions *options.ClientOptions) error {
+	switch m.mechanism {
+	case "", AuthSCRAMSHA1, AuthSCRAMSHA256, AuthX509:
+	default:
+		return ErrUnsupportedMechanism
+	}
+	if m.tls == nil && m.mechanism == AuthX509 {
+		return errors.New("x.509 authentication requires TLS")
+	}
+	if m.tls != nil {
+		config, err := m.tls.config()
+		if err != nil {
+			return err
+		}
+		clientOptions.SetTLSConfig(config)
+	}
+	switch {
+	case m.mechanism == AuthX509:
+		// The server reads the user from the client certificate subject
+		clientOptions.SetAuth(options.Credential{
+			AuthMechanism: AuthX509,
+			AuthSource:    x509Source,
+			Username:      m.username,
+		})
+	case m.username != "":
+		clientOptions.SetAuth(options.Credential{
+			AuthMechanism: m.mechanism,
+			AuthSource:    m.autdb,
+			Username:      m.username,
+			Password:      m.password,
+		})
+	}
+	return nil
+}
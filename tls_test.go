@@ -0,0 +1,181 @@
+package db
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	der         []byte
+}
+
+// issueCertificate create a certificate signed by parent, self signed when
+// parent is nil
+func issueCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Fail to generate key: %s", err.Error())
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Fail to create certificate: %s", err.Error())
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	return &testCertificate{certificate: certificate, key: key, der: der}
+}
+
+func newTestCA(t *testing.T) *testCertificate {
+	return issueCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+// writePEM write certificate and key to a single PEM file
+func (c *testCertificate) writePEM(t *testing.T, name string) string {
+	key, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("Fail to marshal key: %s", err.Error())
+	}
+	path := filepath.Join(t.TempDir(), name)
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key})...)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Fail to write %s: %s", path, err.Error())
+	}
+	return path
+}
+
+// serveTLS accept TLS handshakes with certificate on a local port
+func serveTLS(t *testing.T, certificate *testCertificate) string {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{certificate.der}, PrivateKey: certificate.key}},
+	})
+	if err != nil {
+		t.Fatalf("Fail to listen: %s", err.Error())
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestTLSHostnameVerification(t *testing.T) {
+	ca := newTestCA(t)
+	caFile := ca.writePEM(t, "ca.pem")
+	server := issueCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "mongo.internal"},
+		DNSNames:    []string{"mongo.internal"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	addr := serveTLS(t, server)
+	handshake := func(config TLSConfig) error {
+		tlsConfig, err := config.config()
+		if err != nil {
+			t.Fatalf("Fail to build tls config: %s", err.Error())
+		}
+		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	if err := handshake(TLSConfig{CAFile: caFile}); err == nil {
+		t.Fatalf("Certificates for another host must be rejected")
+	}
+	if err := handshake(TLSConfig{CAFile: caFile, ServerName: "mongo.internal"}); err != nil {
+		t.Fatalf("Certificates for the server name must be accepted but got %s", err.Error())
+	}
+	if err := handshake(TLSConfig{CAFile: caFile, SkipHostnameVerification: true}); err != nil {
+		t.Fatalf("Hostname must not be verified when skipped but got %s", err.Error())
+	}
+	other := newTestCA(t).writePEM(t, "other.pem")
+	if err := handshake(TLSConfig{CAFile: other, SkipHostnameVerification: true}); err == nil {
+		t.Fatalf("Certificates signed by untrusted CAs must be rejected even when hostname verification is skipped")
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("no certificate"), 0600)
+	if _, err := (TLSConfig{CAFile: empty}).config(); err != ErrInvalidCA {
+		t.Fatalf("Bundles without certificate must return ErrInvalidCA but got %v", err)
+	}
+	if _, err := (TLSConfig{CertificateFile: empty}).config(); err == nil {
+		t.Fatalf("Wrong client certificates must return error")
+	}
+}
+
+func TestSecureX509(t *testing.T) {
+	ca := newTestCA(t)
+	client := issueCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "notifier", OrganizationalUnit: []string{"apps"}, Organization: []string{"VNOSS"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	dbhandler := &mongoHandler{host: dbHost, port: dbPort}
+	WithTLS(TLSConfig{CAFile: ca.writePEM(t, "ca.pem"), CertificateFile: client.writePEM(t, "client.pem")})(dbhandler)
+	WithAuthMechanism(AuthX509)(dbhandler)
+	dbhandler.password = "unused"
+	clientOptions := options.Client()
+	if err := dbhandler.secure(clientOptions); err != nil {
+		t.Fatalf("Secure must not return error but got %s", err.Error())
+	}
+	auth := clientOptions.Auth
+	if auth == nil || auth.AuthMechanism != AuthX509 || auth.AuthSource != x509Source || auth.Password != "" || clientOptions.TLSConfig == nil {
+		t.Fatalf("Unexpected client options %+v", clientOptions)
+	}
+	if len(clientOptions.TLSConfig.Certificates) != 1 {
+		t.Fatalf("Client certificate must be presented to the server")
+	}
+}
+
+func TestSecureMechanisms(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	WithAuthMechanism("PLAIN")(dbhandler)
+	if err := dbhandler.secure(options.Client()); err != ErrUnsupportedMechanism {
+		t.Fatalf("PLAIN must return ErrUnsupportedMechanism but got %v", err)
+	}
+	WithAuthMechanism(AuthX509)(dbhandler)
+	if err := dbhandler.secure(options.Client()); err == nil {
+		t.Fatalf("x.509 without TLS must return error")
+	}
+	dbhandler.username, dbhandler.password, dbhandler.autdb = "notifier", "secret", "admin"
+	WithAuthMechanism(AuthSCRAMSHA256)(dbhandler)
+	clientOptions := options.Client()
+	if err := dbhandler.secure(clientOptions); err != nil || clientOptions.TLSConfig != nil {
+		t.Fatalf("SCRAM-SHA-256 without TLS must connect over plain TCP, got %+v and %v", clientOptions, err)
+	}
+	if auth := clientOptions.Auth; auth == nil || auth.AuthMechanism != AuthSCRAMSHA256 || auth.AuthSource != "admin" || auth.Username != "notifier" {
+		t.Fatalf("Unexpected credential %+v", clientOptions.Auth)
+	}
+}
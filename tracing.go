@@ -0,0 +1,61 @@
+package db
+
+import (
+	"encoding/json"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTracing create an OpenTelemetry span for every operation, child of the
+// context given with WithContext. Spans follow database semantic conventions
+// and carry the shape of filters as db.statement unless disabled with
+// WithoutStatements
+func WithTracing(tracer trace.Tracer) Option {
+	return func(m *mongoHandler) {
+		WithMiddleware(m.tracingMiddleware(tracer))(m)
+	}
+}
+
+// WithoutStatements never capture filter shapes in spans of the given
+// collections
+func WithoutStatements(dataNames ...string) Option {
+	return func(m *mongoHandler) {
+		for _, dataName := range dataNames {
+			m.collectionConfig(dataName).noStatements = true
+		}
+	}
+}
+
+func (m *mongoHandler) tracingMiddleware(tracer trace.Tracer) Middleware {
+	return func(call *Call, next Invoker) (interface{}, error) {
+		attributes := []attribute.KeyValue{
+			attribute.String("db.system", "mongodb"),
+			attribute.String("db.name", call.Database),
+			attribute.String("db.operation", call.Operation),
+			attribute.String("db.mongodb.collection", call.DataName),
+			attribute.String("server.address", m.host),
+			attribute.Int("server.port", m.port),
+		}
+		if call.Filter != nil && !m.configOf(call.DataName).noStatements {
+			if statement, err := json.Marshal(filterShape(call.Filter)); err == nil {
+				attributes = append(attributes, attribute.String("db.statement", string(statement)))
+			}
+		}
+		ctx, span := tracer.Start(call.Context, call.Operation+" "+call.Database+"."+call.DataName,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attributes...),
+		)
+		defer span.End()
+		call.Context = ctx
+		result, err := next(call)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else if count, ok := documentCount(result); ok && isReadOperation(call.Operation) {
+			span.SetAttributes(attribute.Int("db.mongodb.documents_returned", count))
+		}
+		return result, err
+	}
+}
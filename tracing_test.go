@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attributes := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+	return attributes
+}
+
+func TestTracingSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	dbhandler := &mongoHandler{host: dbHost, port: dbPort, database: dbName}
+	WithTracing(provider.Tracer("db"))(dbhandler)
+	WithoutStatements("secrets")(dbhandler)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	view := dbhandler.WithContext(ctx).(*mongoHandler)
+	filter := map[string]interface{}{"actorID": 1, "createdAt": map[string]interface{}{"$gte": "2018-09-01"}}
+	view.intercept(&Call{Operation: OperationGetAllItemsNoLimit, DataName: collectionName, Filter: filter}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return []map[string]interface{}{{}, {}}, nil
+	})
+	view.intercept(&Call{Operation: OperationFindBy, DataName: "secrets", Filter: filter}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, ErrNotFound
+	})
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans but got %d", len(spans))
+	}
+	read := spans[0]
+	if read.Name() != "GetAllItemsNoLimit "+dbName+"."+collectionName || read.SpanKind() != trace.SpanKindClient {
+		t.Fatalf("Unexpected span %s of kind %v", read.Name(), read.SpanKind())
+	}
+	if read.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("Span must be a child of the caller span")
+	}
+	attributes := spanAttributes(read)
+	expected := map[attribute.Key]interface{}{
+		"db.system":                     "mongodb",
+		"db.name":                       dbName,
+		"db.operation":                  OperationGetAllItemsNoLimit,
+		"db.mongodb.collection":         collectionName,
+		"db.statement":                  `{"actorID":"?","createdAt":{"$gte":"?"}}`,
+		"db.mongodb.documents_returned": int64(2),
+	}
+	for key, value := range expected {
+		if got := attributes[key].AsInterface(); !reflect.DeepEqual(got, value) {
+			t.Errorf("Attribute %s = %v, want %v", key, got, value)
+		}
+	}
+	failed := spans[1]
+	if failed.Status().Code != codes.Error || len(failed.Events()) != 1 {
+		t.Fatalf("Errors must be recorded on spans, got status %v", failed.Status())
+	}
+	if _, ok := spanAttributes(failed)["db.statement"]; ok {
+		t.Fatalf("Statement must not be captured for collections without statements")
+	}
+}
+
+func TestTracingContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	dbhandler := &mongoHandler{host: dbHost, port: dbPort, database: dbName}
+	WithTracing(provider.Tracer("db"))(dbhandler)
+	var seen, operation trace.SpanContext
+	WithMiddleware(func(call *Call, next Invoker) (interface{}, error) {
+		seen = trace.SpanContextFromContext(call.Context)
+		return next(call)
+	})(dbhandler)
+	dbhandler.intercept(&Call{Operation: OperationFindBy, DataName: collectionName}, func(m *mongoHandler, call *Call) (interface{}, error) {
+		ctx, cancel := m.operationContext()
+		defer cancel()
+		operation = trace.SpanContextFromContext(ctx)
+		return nil, nil
+	})
+	spans := recorder.Ended()
+	if len(spans) != 1 || !seen.IsValid() || seen.SpanID() != spans[0].SpanContext().SpanID() {
+		t.Fatalf("Next middlewares must get the context of the span, got %v", seen)
+	}
+	if operation.SpanID() != seen.SpanID() {
+		t.Fatalf("Operations must run in the context of the span, got %v", operation)
+	}
+}
+
+func TestFilterShape(t *testing.T) {
+	filter := map[string]interface{}{
+		"status": "unread",
+		"$or": []interface{}{
+			map[string]interface{}{"actorID": map[string]interface{}{"$in": []interface{}{1, 2}}},
+			map[string]interface{}{"seen": false},
+		},
+	}
+	expected := map[string]interface{}{
+		"status": "?",
+		"$or": []interface{}{
+			map[string]interface{}{"actorID": map[string]interface{}{"$in": "?"}},
+			map[string]interface{}{"seen": "?"},
+		},
+	}
+	if shape := filterShape(filter); !reflect.DeepEqual(shape, expected) {
+		t.Fatalf("Expected %v but got %v", expected, shape)
+	}
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DefaultVersionField default field storing document version
+	DefaultVersionField = "version"
+	// DefaultConflictRetries number of attempts of read-modify-write cycles
+	DefaultConflictRetries = 5
+)
+
+// ErrVersionConflict is returned when stored version differs from the expected one
+var ErrVersionConflict = errors.New("Version conflict: item was modified concurrently")
+
+// ErrVersioningDisabled is returned by version aware updates of collections without versioning
+var ErrVersioningDisabled = errors.New("Versioning is not enabled for this collection")
+
+// WithVersioning enable optimistic locking for the given collections
+func WithVersioning(dataNames ...string) Option {
+	return func(m *mongoHandler) {
+		for _, dataName := range dataNames {
+			m.collectionConfig(dataName).versioned = true
+		}
+	}
+}
+
+// WithVersionField change the field storing document version
+func WithVersionField(field string) Option {
+	return func(m *mongoHandler) {
+		m.versionField = field
+	}
+}
+
+// versionFieldOf get version field of a collection, empty when not versioned
+func (m *mongoHandler) versionFieldOf(dataName string) string {
+	if !m.configOf(dataName).versioned {
+		return ""
+	}
+	if m.versionField == "" {
+		return DefaultVersionField
+	}
+	return m.versionField
+}
+
+// UpdateByIDIfVersion replace an item only when its stored version equals
+// version. ErrVersionConflict is returned when the item was modified since
+func (m *mongoHandler) UpdateByIDIfVersion(dataName string, id interface{}, version int, update map[string]interface{}) error {
+	call := &Call{Operation: OperationUpdateByIDIfVersion, DataName: dataName, ID: id, Version: version, Document: update}
+	_, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, m.updateByIDIfVersion(call.DataName, call.ID, call.Version, call.Document)
+	})
+	return err
+}
+
+func (m *mongoHandler) updateByIDIfVersion(dataName string, id interface{}, version int, update map[string]interface{}) error {
+	field := m.versionFieldOf(dataName)
+	if field == "" {
+		return ErrVersioningDisabled
+	}
+	// Make sure connection open
+	err := m.GetConnection()
+	if err != nil {
+		log.Printf("[App.db]: Error during get connection for updating item %s. %s\n", id, err)
+		return err
+	}
+	// Make sure to use correct object id
+	objectID, err := createObjectID(id)
+	if err != nil {
+		log.Printf("[App.db]: Error during create object id %s. %s\n", id, err)
+		return err
+	}
+	ctx, cancel := m.operationContext()
+	defer cancel()
+	return m.replaceIfVersion(ctx, m.collection(dataName), dataName, RevisionUpdate, objectID, version, update)
+}
+
+// replaceIfVersion replace an item whose stored version is version, operation
+// is the one recorded in revision history
+func (m *mongoHandler) replaceIfVersion(ctx context.Context, c *mongo.Collection, dataName, operation string, objectID primitive.ObjectID, version int, update map[string]interface{}) error {
+	field := m.versionFieldOf(dataName)
+	// Not allow to update id
+	willUpdateDoc := cloneStringMap(update)
+	delete(willUpdateDoc, "_id")
+	if err := m.stampReplacement(ctx, c, dataName, objectID, willUpdateDoc); err != nil {
+		return err
+	}
+	willUpdateDoc[field] = version + 1
+	var expectedVersion interface{} = version
+	if version == 0 {
+		// Items created before versioning was enabled have no version yet
+		expectedVersion = bson.M{"$in": []interface{}{0, nil}}
+	}
+	willSelector := m.scopeFilter(dataName, bson.M{"_id": objectID, field: expectedVersion})
+	tracker, err := m.trackRevisions(ctx, c, dataName, operation, willSelector, 1)
+	if err != nil {
+		return err
+	}
+	err = replaceOne(ctx, c, willSelector, willUpdateDoc)
+	if err == nil {
+		tracker.record()
+		return nil
+	}
+	if err != ErrNotFound {
+		return err
+	}
+	// Tell apart a missing item from a concurrent modification
+	count, countErr := m.countItems(ctx, c, m.scopeFilter(dataName, bson.M{"_id": objectID}))
+	if countErr != nil {
+		return countErr
+	}
+	if count > 0 {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+// replaceLatestVersion replace an item whatever its current version is,
+// still bumping the version and retrying when a concurrent write happens
+func (m *mongoHandler) replaceLatestVersion(ctx context.Context, c *mongo.Collection, dataName string, objectID primitive.ObjectID, update map[string]interface{}) error {
+	field := m.versionFieldOf(dataName)
+	return RetryOnConflict(DefaultConflictRetries, func() error {
+		var stored bson.M
+		err := m.findOne(ctx, c, m.scopeFilter(dataName, bson.M{"_id": objectID}), &stored, options.FindOne().SetProjection(bson.M{field: 1}))
+		if err != nil {
+			return err
+		}
+		version := versionOf(stored, field)
+		return m.replaceIfVersion(ctx, c, dataName, RevisionUpdate, objectID, version, update)
+	})
+}
+
+// ModifyByID run a read-modify-write cycle on an item of a versioned
+// collection: modify receives a copy of the stored item and the result is
+// saved with UpdateByIDIfVersion, starting over when a conflict happens
+func (m *mongoHandler) ModifyByID(dataName string, id interface{}, modify func(item map[string]interface{}) error) error {
+	call := &Call{Operation: OperationModifyByID, DataName: dataName, ID: id}
+	_, err := m.intercept(call, func(m *mongoHandler, call *Call) (interface{}, error) {
+		return nil, m.modifyByID(call.DataName, call.ID, modify)
+	})
+	return err
+}
+
+func (m *mongoHandler) modifyByID(dataName string, id interface{}, modify func(item map[string]interface{}) error) error {
+	field := m.versionFieldOf(dataName)
+	if field == "" {
+		return ErrVersioningDisabled
+	}
+	return RetryOnConflict(DefaultConflictRetries, func() error {
+		item, err := m.findItemByID(dataName, id)
+		if err != nil {
+			return err
+		}
+		version := versionOf(item, field)
+		if err := modify(item); err != nil {
+			return err
+		}
+		if item, err = m.tenantDocument(item); err != nil {
+			return err
+		}
+		if err := m.validateItem(dataName, item); err != nil {
+			return err
+		}
+		return m.updateByIDIfVersion(dataName, id, version, item)
+	})
+}
+
+// RetryOnConflict call fn until it returns an error other than
+// ErrVersionConflict or attempts are exhausted
+func RetryOnConflict(attempts int, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if err = fn(); err != ErrVersionConflict {
+			return err
+		}
+	}
+	return err
+}
+
+// versionOf read the version of a document, missing versions count as 0
+func versionOf(doc map[string]interface{}, field string) int {
+	switch version := doc[field].(type) {
+	case int:
+		return version
+	case int32:
+		return int(version)
+	case int64:
+		return int(version)
+	case float64:
+		return int(version)
+	}
+	return 0
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRetryOnConflict(t *testing.T) {
+	calls := 0
+	err := RetryOnConflict(3, func() error {
+		calls++
+		return ErrVersionConflict
+	})
+	if err != ErrVersionConflict || calls != 3 {
+		t.Fatalf("Expected 3 attempts ending with conflict but got %d attempts and %v", calls, err)
+	}
+	calls = 0
+	failure := errors.New("failure")
+	err = RetryOnConflict(3, func() error {
+		calls++
+		if calls == 1 {
+			return ErrVersionConflict
+		}
+		return failure
+	})
+	if err != failure || calls != 2 {
+		t.Fatalf("Expected to stop on other errors but got %d attempts and %v", calls, err)
+	}
+}
+
+func TestVersionOf(t *testing.T) {
+	for _, version := range []interface{}{3, int32(3), int64(3), float64(3)} {
+		if got := versionOf(map[string]interface{}{"version": version}, "version"); got != 3 {
+			t.Fatalf("Expected version 3 from %T but got %d", version, got)
+		}
+	}
+	if got := versionOf(map[string]interface{}{}, "version"); got != 0 {
+		t.Fatalf("Missing version must count as 0 but got %d", got)
+	}
+}
+
+func TestUpdateOperatorsBumpVersion(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	WithVersioning(collectionName)(dbhandler)
+	WithVersionField("rev")(dbhandler)
+	operators := dbhandler.updateOperators(collectionName, map[string]interface{}{"seen": true, "rev": 10}, false)
+	expected := bson.M{
+		"$set": map[string]interface{}{"seen": true},
+		"$inc": bson.M{"rev": 1},
+	}
+	if !reflect.DeepEqual(operators, expected) {
+		t.Fatalf("Expected %v but got %v", expected, operators)
+	}
+}
+
+func newVersioningTestHandler(t *testing.T) *mongoHandler {
+	dbhandler := newTestHandler(t)
+	WithVersioning(collectionName)(dbhandler)
+	return dbhandler
+}
+
+func TestVersioningDisabled(t *testing.T) {
+	dbhandler := &mongoHandler{}
+	if err := dbhandler.UpdateByIDIfVersion(collectionName, fixtureFirstMessageID, 1, map[string]interface{}{"seen": true}); err != ErrVersioningDisabled {
+		t.Fatalf("Expected %v but got %v", ErrVersioningDisabled, err)
+	}
+	err := dbhandler.ModifyByID(collectionName, fixtureFirstMessageID, func(item map[string]interface{}) error {
+		return nil
+	})
+	if err != ErrVersioningDisabled || errorClass(err) != "invalid_argument" || statusOf(err) != http.StatusBadRequest {
+		t.Fatalf("ErrVersioningDisabled must be a caller error, got %v", err)
+	}
+}
+
+func TestUpdateByIDIfVersion(t *testing.T) {
+	dbhandler := newVersioningTestHandler(t)
+	inserted, err := dbhandler.AddNewItem(collectionName, map[string]interface{}{"content": "This is test message", "seen": false})
+	if err != nil {
+		t.Fatalf("Insert item must not return error but got %s", err.Error())
+	}
+	if inserted[DefaultVersionField] != 1 {
+		t.Fatalf("Inserted item must start at version 1, got %v", inserted)
+	}
+	err = dbhandler.UpdateByIDIfVersion(collectionName, inserted["_id"], 1, map[string]interface{}{"content": "first writer", "seen": true})
+	if err != nil {
+		t.Fatalf("Update with current version must not return error but got %s", err.Error())
+	}
+	err = dbhandler.UpdateByIDIfVersion(collectionName, inserted["_id"], 1, map[string]interface{}{"content": "second writer"})
+	if err != ErrVersionConflict {
+		t.Fatalf("Update with stale version must return %v but got %v", ErrVersionConflict, err)
+	}
+	found, err := dbhandler.FindItemByID(collectionName, inserted["_id"])
+	if err != nil {
+		t.Fatalf("Error during find message by ID: %s", err.Error())
+	}
+	if found["content"] != "first writer" || versionOf(found, DefaultVersionField) != 2 {
+		t.Fatalf("Stale update must not overwrite item, got %v", found)
+	}
+	err = dbhandler.UpdateByIDIfVersion(collectionName, primitive.NewObjectID(), 1, map[string]interface{}{})
+	if err == nil || err == ErrVersionConflict {
+		t.Fatalf("Update of a missing item must return not found but got %v", err)
+	}
+}
+
+func TestVersionBumpedOnEveryUpdate(t *testing.T) {
+	dbhandler := newVersioningTestHandler(t)
+	inserted, err := dbhandler.AddNewItem(collectionName, map[string]interface{}{"content": "This is test message", "targetUserID": 12})
+	if err != nil {
+		t.Fatalf("Insert item must not return error but got %s", err.Error())
+	}
+	if err = dbhandler.UpdateByID(collectionName, inserted["_id"], map[string]interface{}{"content": "replaced", "targetUserID": 12}); err != nil {
+		t.Fatalf("Update by id must not return error but got %s", err.Error())
+	}
+	if _, err = dbhandler.UpdateBy(collectionName, map[string]interface{}{"targetUserID": 12}, map[string]interface{}{"seen": true}); err != nil {
+		t.Fatalf("Update by must not return error but got %s", err.Error())
+	}
+	found, err := dbhandler.FindItemByID(collectionName, inserted["_id"])
+	if err != nil {
+		t.Fatalf("Error during find message by ID: %s", err.Error())
+	}
+	if versionOf(found, DefaultVersionField) != 3 {
+		t.Fatalf("Each update must bump version, got %v", found)
+	}
+}
+
+func TestModifyByID(t *testing.T) {
+	dbhandler := newVersioningTestHandler(t)
+	inserted, err := dbhandler.AddNewItem(collectionName, map[string]interface{}{"counter": 0})
+	if err != nil {
+		t.Fatalf("Insert item must not return error but got %s", err.Error())
+	}
+	attempts := 0
+	err = dbhandler.ModifyByID(collectionName, inserted["_id"], func(item map[string]interface{}) error {
+		attempts++
+		if attempts == 1 {
+			// Simulate a concurrent writer between read and write
+			if _, err := dbhandler.UpdateBy(collectionName, map[string]interface{}{"_id": mustObjectID(item["_id"].(string))}, map[string]interface{}{"other": true}); err != nil {
+				return err
+			}
+		}
+		item["counter"] = item["counter"].(int) + 1
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Modify must not return error but got %s", err.Error())
+	}
+	if attempts != 2 {
+		t.Fatalf("Modify must retry after a conflict, got %d attempts", attempts)
+	}
+	found, err := dbhandler.FindItemByID(collectionName, inserted["_id"])
+	if err != nil {
+		t.Fatalf("Error during find message by ID: %s", err.Error())
+	}
+	if found["counter"] != 1 || found["other"] != true {
+		t.Fatalf("Modify must apply on latest item, got %v", found)
+	}
+}
@@ -0,0 +1,43 @@
+package db
+
+import "context"
+
+// view create a shallow copy of the handler sharing the connection of the
+// root handler, so calls can be scoped without opening another connection
+func (m *mongoHandler) view() *mongoHandler {
+	view := *m
+	view.parent = m.root()
+	view.connection = nil
+	return &view
+}
+
+// root get the handler owning the connection
+func (m *mongoHandler) root() *mongoHandler {
+	if m.parent != nil {
+		return m.parent
+	}
+	return m
+}
+
+// WithContext get a view of the handler running its calls under ctx,
+// so middlewares such as tracing can link them to the caller
+func (m *mongoHandler) WithContext(ctx context.Context) DatabaseHandler {
+	view := m.view()
+	view.ctx = ctx
+	return view
+}
+
+func (m *mongoHandler) context() context.Context {
+	if m.ctx != nil {
+		return m.ctx
+	}
+	return context.Background()
+}
+
+// AsActor get a view of the handler attributing its mutations to actor in
+// revision history
+func (m *mongoHandler) AsActor(actor string) DatabaseHandler {
+	view := m.view()
+	view.actor = actor
+	return view
+}